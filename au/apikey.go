@@ -0,0 +1,246 @@
+package au
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	APIKeyHeader       = "X-API-Key" // 默认读取 API Key 的请求头
+	APIKeyQuery        = "api_key"   // 默认读取 API Key 的查询参数
+	ClaimAPIKey        = "api_key"   // Principal.Value 中 API Key 标识的名称，用于 auth 标签
+	DefaultQuotaWindow = time.Minute
+)
+
+// API Key 错误。
+var (
+	ErrAPIKeyInvalid  = authErrors.Define("api_key_invalid", http.StatusUnauthorized, "auth.api_key_invalid", "无效的 API Key")
+	ErrQuotaExceeded  = authErrors.Define("quota_exceeded", http.StatusTooManyRequests, "auth.quota_exceeded", "请求次数超过配额")
+	ErrRouteForbidden = authErrors.Define("route_forbidden", http.StatusForbidden, "auth.route_forbidden", "API Key 不允许访问该接口")
+)
+
+// APIKey 合作方客户端的 API Key 信息，不包含密钥本身。
+type APIKey struct {
+	ID          string        // 密钥标识，用于日志与按密钥限流
+	ClientID    string        // 客户端标识，作为 Principal.ID
+	TenantID    string        // 租户 ID
+	Routes      []string      // 允许访问的路由完整名称，支持 path.Match 通配符，例如 "pet.*"，为空时允许全部
+	Roles       []string      // 角色
+	Permissions []string      // 权限
+	RateLimit   int           // 每个 RateWindow 内允许的请求次数，0 表示不限制
+	RateWindow  time.Duration // 配额窗口，默认 DefaultQuotaWindow
+	ExpiresAt   time.Time     // 过期时间，零值表示不过期
+}
+
+// Allows 判断 API Key 是否允许访问指定名称的路由。
+// name: 路由的完整名称，例如 "pet.新建"。
+func (k *APIKey) Allows(name string) bool {
+	if len(k.Routes) == 0 {
+		return true
+	}
+	for _, pattern := range k.Routes {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyStore 根据密钥查找 API Key。
+type APIKeyStore interface {
+	// Lookup 查找密钥对应的 API Key，不存在时返回 nil, nil。
+	Lookup(ctx context.Context, key string) (*APIKey, error)
+}
+
+// HashAPIKey 返回密钥的 SHA-256 摘要，存储中只保存摘要。
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeys 基于 API Key 的认证，并按密钥限制请求次数，实现了 Authenticator 接口。
+type APIKeys struct {
+	Store  APIKeyStore
+	Header string // 读取密钥的请求头，默认 APIKeyHeader
+	Query  string // 读取密钥的查询参数，默认 APIKeyQuery
+
+	mu      sync.Mutex
+	windows map[string]*quotaWindow
+}
+
+// quotaWindow 固定窗口内的请求计数。
+type quotaWindow struct {
+	count int
+	reset time.Time
+}
+
+// NewAPIKeys 创建 API Key 认证。
+// store: API Key 存储。
+func NewAPIKeys(store APIKeyStore) *APIKeys {
+	return &APIKeys{Store: store, Header: APIKeyHeader, Query: APIKeyQuery}
+}
+
+// Authenticate 实现 Authenticator 接口。
+// 配额不在认证时消耗，而是由 rt 在校验 API Key 允许的路由之后调用 Principal.TakeQuota 消耗，
+// 因此访问不允许的路由不会消耗配额；不使用 rt 时需自行调用 Principal.TakeQuota。
+func (a *APIKeys) Authenticate(r *http.Request) (*Principal, error) {
+	header, query := a.Header, a.Query
+	if header == "" {
+		header = APIKeyHeader
+	}
+	if query == "" {
+		query = APIKeyQuery
+	}
+	key := r.Header.Get(header)
+	if key == "" {
+		key = r.URL.Query().Get(query)
+	}
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+
+	apiKey, err := a.Store.Lookup(r.Context(), key)
+	if err != nil {
+		return nil, err
+	}
+	if apiKey == nil || !apiKey.ExpiresAt.IsZero() && time.Now().After(apiKey.ExpiresAt) {
+		return nil, ErrAPIKeyInvalid
+	}
+	return &Principal{
+		ID:          apiKey.ClientID,
+		TenantID:    apiKey.TenantID,
+		Roles:       apiKey.Roles,
+		Permissions: apiKey.Permissions,
+		APIKey:      apiKey,
+		quota:       func() bool { return a.take(apiKey) },
+	}, nil
+}
+
+// TakeQuota 消耗一次 API Key 的配额，超过配额时返回 ErrQuotaExceeded，不是通过 API Key 认证的用户返回 nil。
+func (p *Principal) TakeQuota() error {
+	if p.quota == nil || p.quota() {
+		return nil
+	}
+	return ErrQuotaExceeded
+}
+
+// take 消耗一次配额，超过配额时返回 false。
+func (a *APIKeys) take(apiKey *APIKey) bool {
+	if apiKey.RateLimit <= 0 {
+		return true
+	}
+	window := apiKey.RateWindow
+	if window <= 0 {
+		window = DefaultQuotaWindow
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.windows == nil {
+		a.windows = map[string]*quotaWindow{}
+	}
+	now := time.Now()
+	current, ok := a.windows[apiKey.ID]
+	if !ok || now.After(current.reset) {
+		current = &quotaWindow{reset: now.Add(window)}
+		a.windows[apiKey.ID] = current
+	}
+	if current.count >= apiKey.RateLimit {
+		return false
+	}
+	current.count++
+	return true
+}
+
+// MemoryAPIKeyStore 内存中的 API Key 存储。
+type MemoryAPIKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]*APIKey
+}
+
+// NewMemoryAPIKeyStore 创建内存 API Key 存储。
+func NewMemoryAPIKeyStore() *MemoryAPIKeyStore {
+	return &MemoryAPIKeyStore{keys: map[string]*APIKey{}}
+}
+
+// Add 添加 API Key。
+// key: 密钥。
+// apiKey: 密钥对应的信息。
+func (m *MemoryAPIKeyStore) Add(key string, apiKey *APIKey) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys[HashAPIKey(key)] = apiKey
+}
+
+// Remove 删除 API Key。
+func (m *MemoryAPIKeyStore) Remove(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.keys, HashAPIKey(key))
+}
+
+// Lookup 实现 APIKeyStore 接口。
+func (m *MemoryAPIKeyStore) Lookup(ctx context.Context, key string) (*APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.keys[HashAPIKey(key)], nil
+}
+
+// APIKeyRecord API Key 表的模型，只保存密钥的摘要。
+type APIKeyRecord struct {
+	ID          string   `gorm:"primaryKey;size:64"`
+	KeyHash     string   `gorm:"uniqueIndex;size:64"`
+	ClientID    string   `gorm:"size:64"`
+	TenantID    string   `gorm:"size:64"`
+	Routes      []string `gorm:"serializer:json"`
+	Roles       []string `gorm:"serializer:json"`
+	Permissions []string `gorm:"serializer:json"`
+	RateLimit   int
+	RateWindow  time.Duration
+	ExpiresAt   *time.Time
+}
+
+// DBAPIKeyStore 数据库中的 API Key 存储，使用 APIKeyRecord 表。
+type DBAPIKeyStore struct {
+	db *gorm.DB
+}
+
+// NewDBAPIKeyStore 创建数据库 API Key 存储。
+// db: 数据库连接，需已迁移 APIKeyRecord。
+func NewDBAPIKeyStore(db *gorm.DB) *DBAPIKeyStore {
+	return &DBAPIKeyStore{db: db}
+}
+
+// Lookup 实现 APIKeyStore 接口。
+func (s *DBAPIKeyStore) Lookup(ctx context.Context, key string) (*APIKey, error) {
+	var record APIKeyRecord
+	err := s.db.WithContext(ctx).Where("key_hash = ?", HashAPIKey(key)).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	apiKey := &APIKey{
+		ID:          record.ID,
+		ClientID:    record.ClientID,
+		TenantID:    record.TenantID,
+		Routes:      record.Routes,
+		Roles:       record.Roles,
+		Permissions: record.Permissions,
+		RateLimit:   record.RateLimit,
+		RateWindow:  record.RateWindow,
+	}
+	if record.ExpiresAt != nil {
+		apiKey.ExpiresAt = *record.ExpiresAt
+	}
+	return apiKey, nil
+}
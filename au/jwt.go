@@ -0,0 +1,249 @@
+package au
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/spf13/viper"
+)
+
+const (
+	TokenAccess       = "access"  // 访问令牌
+	TokenRefresh      = "refresh" // 刷新令牌，只能用于 JWT.Refresh
+	DefaultAccessTTL  = 2 * time.Hour
+	DefaultRefreshTTL = 7 * 24 * time.Hour
+	claimSubject      = "sub"
+	claimTenant       = "tid"
+	claimRoles        = "roles"
+	claimPermissions  = "perms"
+	claimType         = "typ"
+)
+
+// JWTConfig JWT 的配置。
+type JWTConfig struct {
+	Method     string          // 签名算法，支持 HS256/HS384/HS512/RS256/RS384/RS512，默认 HS256
+	Secret     []byte          // HS 算法的密钥
+	PrivateKey *rsa.PrivateKey // RS 算法的私钥，只校验令牌时可为空
+	PublicKey  *rsa.PublicKey  // RS 算法的公钥，为空时使用私钥对应的公钥
+	Issuer     string          // 签发者，设置后校验令牌的 iss
+	AccessTTL  time.Duration   // 访问令牌有效期，默认 DefaultAccessTTL
+	RefreshTTL time.Duration   // 刷新令牌有效期，默认 DefaultRefreshTTL
+	Cookie     string          // 读取令牌的 Cookie 名称，为空时只读取 Authorization 头部
+}
+
+// TokenPair 签发的访问令牌与刷新令牌。
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"` // 访问令牌的有效秒数
+}
+
+// JWT 签发与校验 JWT，实现了 Authenticator 接口。
+type JWT struct {
+	config    JWTConfig
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// NewJWT 根据配置创建 JWT。
+func NewJWT(config JWTConfig) (*JWT, error) {
+	if config.Method == "" {
+		config.Method = jwt.SigningMethodHS256.Alg()
+	}
+	if config.AccessTTL <= 0 {
+		config.AccessTTL = DefaultAccessTTL
+	}
+	if config.RefreshTTL <= 0 {
+		config.RefreshTTL = DefaultRefreshTTL
+	}
+
+	j := &JWT{config: config, method: jwt.GetSigningMethod(config.Method)}
+	switch j.method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if len(config.Secret) == 0 {
+			return nil, fmt.Errorf("au: %s requires a secret", config.Method)
+		}
+		j.signKey, j.verifyKey = config.Secret, config.Secret
+	case *jwt.SigningMethodRSA:
+		publicKey := config.PublicKey
+		if publicKey == nil && config.PrivateKey != nil {
+			publicKey = &config.PrivateKey.PublicKey
+		}
+		if publicKey == nil {
+			return nil, fmt.Errorf("au: %s requires a public or private key", config.Method)
+		}
+		if config.PrivateKey != nil {
+			j.signKey = config.PrivateKey
+		}
+		j.verifyKey = publicKey
+	default:
+		return nil, fmt.Errorf("au: unsupported signing method '%s'", config.Method)
+	}
+	return j, nil
+}
+
+// LoadJWT 根据 viper 中的 Auth 配置创建 JWT。
+// 配置项：Method、Secret、PrivateKeyFile、PublicKeyFile、Issuer、AccessTTL、RefreshTTL、Cookie。
+func LoadJWT() (*JWT, error) {
+	config := JWTConfig{
+		Method:     viper.GetString("Auth.Method"),
+		Secret:     []byte(viper.GetString("Auth.Secret")),
+		Issuer:     viper.GetString("Auth.Issuer"),
+		AccessTTL:  viper.GetDuration("Auth.AccessTTL"),
+		RefreshTTL: viper.GetDuration("Auth.RefreshTTL"),
+		Cookie:     viper.GetString("Auth.Cookie"),
+	}
+	if file := viper.GetString("Auth.PrivateKeyFile"); file != "" {
+		pem, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("au: read private key: %w", err)
+		}
+		if config.PrivateKey, err = jwt.ParseRSAPrivateKeyFromPEM(pem); err != nil {
+			return nil, fmt.Errorf("au: parse private key: %w", err)
+		}
+	}
+	if file := viper.GetString("Auth.PublicKeyFile"); file != "" {
+		pem, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("au: read public key: %w", err)
+		}
+		if config.PublicKey, err = jwt.ParseRSAPublicKeyFromPEM(pem); err != nil {
+			return nil, fmt.Errorf("au: parse public key: %w", err)
+		}
+	}
+	return NewJWT(config)
+}
+
+// Issue 为用户签发访问令牌与刷新令牌。
+func (j *JWT) Issue(principal *Principal) (TokenPair, error) {
+	if j.signKey == nil {
+		return TokenPair{}, fmt.Errorf("au: %s requires a private key to sign", j.config.Method)
+	}
+	now := time.Now()
+	accessToken, err := j.sign(principal, TokenAccess, now, j.config.AccessTTL)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	refreshToken, err := j.sign(principal, TokenRefresh, now, j.config.RefreshTTL)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(j.config.AccessTTL / time.Second),
+	}, nil
+}
+
+// Refresh 校验刷新令牌并签发新的令牌。
+// refreshToken: Issue 签发的刷新令牌。
+func (j *JWT) Refresh(refreshToken string) (TokenPair, error) {
+	principal, err := j.Parse(refreshToken, TokenRefresh)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return j.Issue(principal)
+}
+
+// Parse 校验令牌并返回其中的用户。
+// token: 令牌。
+// tokenType: 令牌类型，TokenAccess 或 TokenRefresh。
+func (j *JWT) Parse(token, tokenType string) (*Principal, error) {
+	options := []jwt.ParserOption{jwt.WithValidMethods([]string{j.config.Method}), jwt.WithExpirationRequired()}
+	if j.config.Issuer != "" {
+		options = append(options, jwt.WithIssuer(j.config.Issuer))
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return j.verifyKey, nil
+	}, options...)
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return nil, ErrTokenExpired
+	}
+	if err != nil || claims[claimType] != tokenType {
+		return nil, ErrTokenInvalid
+	}
+	return principalFromClaims(claims), nil
+}
+
+// Authenticate 实现 Authenticator 接口，依次从 Authorization: Bearer 头部与 Cookie 读取访问令牌。
+func (j *JWT) Authenticate(r *http.Request) (*Principal, error) {
+	token := ""
+	if scheme, credentials, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		token = strings.TrimSpace(credentials)
+	} else if j.config.Cookie != "" {
+		if cookie, err := r.Cookie(j.config.Cookie); err == nil {
+			token = cookie.Value
+		}
+	}
+	if token == "" {
+		return nil, ErrNoCredentials
+	}
+	return j.Parse(token, TokenAccess)
+}
+
+// sign 签发指定类型的令牌，保留的声明覆盖 Principal.Claims 中的同名声明。
+func (j *JWT) sign(principal *Principal, tokenType string, now time.Time, ttl time.Duration) (string, error) {
+	claims := jwt.MapClaims{}
+	for key, value := range principal.Claims {
+		claims[key] = value
+	}
+	claims[claimSubject] = principal.ID
+	claims[claimType] = tokenType
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(ttl).Unix()
+	if principal.TenantID != "" {
+		claims[claimTenant] = principal.TenantID
+	}
+	if len(principal.Roles) > 0 {
+		claims[claimRoles] = principal.Roles
+	}
+	if len(principal.Permissions) > 0 {
+		claims[claimPermissions] = principal.Permissions
+	}
+	if j.config.Issuer != "" {
+		claims["iss"] = j.config.Issuer
+	}
+	return jwt.NewWithClaims(j.method, claims).SignedString(j.signKey)
+}
+
+// principalFromClaims 根据令牌声明生成用户，Claims 中不包含保留的声明。
+func principalFromClaims(claims jwt.MapClaims) *Principal {
+	principal := &Principal{Claims: map[string]interface{}{}}
+	for key, value := range claims {
+		switch key {
+		case claimSubject:
+			principal.ID = fmt.Sprint(value)
+		case claimTenant:
+			principal.TenantID = fmt.Sprint(value)
+		case claimRoles:
+			principal.Roles = toStrings(value)
+		case claimPermissions:
+			principal.Permissions = toStrings(value)
+		case claimType, "iat", "exp", "nbf", "iss":
+		default:
+			principal.Claims[key] = value
+		}
+	}
+	return principal
+}
+
+// toStrings 将 JSON 数组转换为字符串切片。
+func toStrings(value interface{}) []string {
+	items, _ := value.([]interface{})
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		result = append(result, fmt.Sprint(item))
+	}
+	return result
+}
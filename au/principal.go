@@ -0,0 +1,120 @@
+// Package au 提供了认证相关的功能，包括 JWT、会话以及将当前用户写入请求上下文的中间件。
+package au
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/QingShan-Xu/web/bm"
+)
+
+// ErrNoCredentials 请求中没有当前认证方式所需的凭证，Middleware 将继续尝试下一个认证方式。
+var ErrNoCredentials = errors.New("au: no credentials")
+
+// 认证错误。
+var (
+	authErrors        = bm.NewErrorModule("auth")
+	ErrTokenInvalid   = authErrors.Define("token_invalid", http.StatusUnauthorized, "auth.token_invalid", "无效的令牌")
+	ErrTokenExpired   = authErrors.Define("token_expired", http.StatusUnauthorized, "auth.token_expired", "令牌已过期")
+	ErrSessionInvalid = authErrors.Define("session_invalid", http.StatusUnauthorized, "auth.session_invalid", "会话已失效")
+)
+
+// Principal 当前认证的用户。
+type Principal struct {
+	ID          string                 // 用户 ID，对应 JWT 的 sub
+	TenantID    string                 // 租户 ID
+	Roles       []string               // 角色
+	Permissions []string               // 权限
+	Claims      map[string]interface{} // 其余声明
+	APIKey      *APIKey                // 通过 API Key 认证时的密钥信息
+
+	quota func() bool // 消耗一次 API Key 配额，超过配额时返回 false
+}
+
+// Authenticator 从请求中解析当前用户。
+type Authenticator interface {
+	// Authenticate 解析请求中的凭证，没有凭证时返回 ErrNoCredentials。
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// AuthenticatorFunc 函数形式的 Authenticator。
+type AuthenticatorFunc func(r *http.Request) (*Principal, error)
+
+// Authenticate 实现 Authenticator 接口。
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (*Principal, error) {
+	return f(r)
+}
+
+// authState 认证中间件写入上下文的认证结果。
+type authState struct {
+	principal *Principal
+	err       error
+}
+
+type contextKey struct{}
+
+// Value 按名称读取用户信息，用于填充 Bind 中带有 auth 标签的字段。
+// name: id、user_id、sub、tenant_id、roles、permissions、api_key 或其余声明的名称。
+func (p *Principal) Value(name string) (interface{}, bool) {
+	switch name {
+	case "id", "user_id", claimSubject:
+		return p.ID, p.ID != ""
+	case "tenant_id", claimTenant:
+		return p.TenantID, p.TenantID != ""
+	case "roles":
+		return p.Roles, p.Roles != nil
+	case "permissions", claimPermissions:
+		return p.Permissions, p.Permissions != nil
+	case ClaimAPIKey:
+		if p.APIKey == nil {
+			return nil, false
+		}
+		return p.APIKey.ID, true
+	}
+	value, ok := p.Claims[name]
+	return value, ok
+}
+
+// Middleware 依次使用 authenticators 认证请求，并将结果写入请求上下文。
+// 认证失败时不会中止请求，由 rt 根据 Router.Public 决定是否返回 401。
+// authenticators: 认证方式，第一个找到凭证的认证方式决定认证结果。
+func Middleware(authenticators ...Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			state := &authState{err: bm.ErrUnauthorized}
+			for _, authenticator := range authenticators {
+				principal, err := authenticator.Authenticate(r)
+				if errors.Is(err, ErrNoCredentials) || err == nil && principal == nil {
+					continue
+				}
+				state = &authState{principal: principal, err: err}
+				break
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, state)))
+		})
+	}
+}
+
+// WithPrincipal 返回带有当前用户的上下文。
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, &authState{principal: principal})
+}
+
+// FromContext 返回上下文中认证成功的用户。
+func FromContext(ctx context.Context) (*Principal, bool) {
+	state, ok := ctx.Value(contextKey{}).(*authState)
+	if !ok || state.err != nil || state.principal == nil {
+		return nil, false
+	}
+	return state.principal, true
+}
+
+// ErrorFrom 返回认证中间件记录的认证错误，未经过认证中间件或认证成功时返回 nil。
+func ErrorFrom(ctx context.Context) error {
+	state, ok := ctx.Value(contextKey{}).(*authState)
+	if !ok {
+		return nil
+	}
+	return state.err
+}
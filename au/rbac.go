@@ -0,0 +1,140 @@
+package au
+
+import (
+	"context"
+	"path"
+	"sync"
+
+	"github.com/QingShan-Xu/web/bm"
+	"gorm.io/gorm"
+)
+
+// Authorizer 校验用户是否满足路由声明的角色与权限。
+type Authorizer interface {
+	// Authorize 用户拥有 roles 中的任一角色且拥有全部 permissions 时返回 nil，否则返回 bm.ErrForbidden。
+	Authorize(ctx context.Context, principal *Principal, roles, permissions []string) error
+}
+
+// RoleStore 查询角色被授予的权限。
+type RoleStore interface {
+	Permissions(ctx context.Context, roles []string) ([]string, error)
+}
+
+// RBAC 基于角色的访问控制，用户的权限为自身的 Permissions 加上其角色被授予的权限。
+// 权限支持 path.Match 通配符，例如 "pet.*" 或 "*"。
+type RBAC struct {
+	store RoleStore
+}
+
+// NewRBAC 创建 RBAC。
+// store: 角色权限存储，为 nil 时只使用用户自身的 Permissions。
+func NewRBAC(store RoleStore) *RBAC {
+	return &RBAC{store: store}
+}
+
+// Authorize 实现 Authorizer 接口。
+func (a *RBAC) Authorize(ctx context.Context, principal *Principal, roles, permissions []string) error {
+	if len(roles) > 0 && !hasAny(principal.Roles, roles) {
+		return bm.ErrForbidden
+	}
+	if len(permissions) == 0 {
+		return nil
+	}
+
+	granted := principal.Permissions
+	if a.store != nil && len(principal.Roles) > 0 {
+		rolePermissions, err := a.store.Permissions(ctx, principal.Roles)
+		if err != nil {
+			return err
+		}
+		granted = append(append([]string{}, granted...), rolePermissions...)
+	}
+	for _, permission := range permissions {
+		if !matchAny(granted, permission) {
+			return bm.ErrForbidden
+		}
+	}
+	return nil
+}
+
+// hasAny 判断 have 中是否包含 want 中的任一项。
+func hasAny(have, want []string) bool {
+	for _, item := range want {
+		for _, candidate := range have {
+			if candidate == item {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchAny 判断已授予的权限中是否有匹配 permission 的项。
+func matchAny(granted []string, permission string) bool {
+	for _, pattern := range granted {
+		if matched, _ := path.Match(pattern, permission); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// MemoryRoleStore 内存中的角色权限存储。
+type MemoryRoleStore struct {
+	mu    sync.RWMutex
+	roles map[string][]string
+}
+
+// NewMemoryRoleStore 创建内存角色权限存储。
+func NewMemoryRoleStore() *MemoryRoleStore {
+	return &MemoryRoleStore{roles: map[string][]string{}}
+}
+
+// Grant 为角色授予权限。
+func (m *MemoryRoleStore) Grant(role string, permissions ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.roles[role] = append(m.roles[role], permissions...)
+}
+
+// Revoke 撤销角色的全部权限。
+func (m *MemoryRoleStore) Revoke(role string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.roles, role)
+}
+
+// Permissions 实现 RoleStore 接口。
+func (m *MemoryRoleStore) Permissions(ctx context.Context, roles []string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var permissions []string
+	for _, role := range roles {
+		permissions = append(permissions, m.roles[role]...)
+	}
+	return permissions, nil
+}
+
+// RolePermission 角色权限表的模型。
+type RolePermission struct {
+	Role       string `gorm:"primaryKey;size:64"`
+	Permission string `gorm:"primaryKey;size:128"`
+}
+
+// DBRoleStore 数据库中的角色权限存储，使用 RolePermission 表。
+type DBRoleStore struct {
+	db *gorm.DB
+}
+
+// NewDBRoleStore 创建数据库角色权限存储。
+// db: 数据库连接，需已迁移 RolePermission。
+func NewDBRoleStore(db *gorm.DB) *DBRoleStore {
+	return &DBRoleStore{db: db}
+}
+
+// Permissions 实现 RoleStore 接口。
+func (s *DBRoleStore) Permissions(ctx context.Context, roles []string) ([]string, error) {
+	var permissions []string
+	err := s.db.WithContext(ctx).Model(&RolePermission{}).Where("role IN ?", roles).Pluck("permission", &permissions).Error
+	return permissions, err
+}
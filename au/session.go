@@ -0,0 +1,151 @@
+package au
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultSessionCookie = "session_id"
+	DefaultSessionTTL    = 24 * time.Hour
+	sessionIDBytes       = 32
+	sessionSweepInterval = time.Minute
+)
+
+// SessionStore 会话存储。
+type SessionStore interface {
+	Get(id string) (*Principal, bool)
+	Set(id string, principal *Principal, ttl time.Duration)
+	Delete(id string)
+}
+
+// Session 基于 Cookie 与服务端存储的会话认证，实现了 Authenticator 接口。
+type Session struct {
+	Store  SessionStore
+	Cookie string        // Cookie 名称，默认 DefaultSessionCookie
+	TTL    time.Duration // 会话有效期，默认 DefaultSessionTTL
+	Secure bool          // Cookie 是否只通过 HTTPS 发送
+}
+
+// NewSession 创建使用默认 Cookie 名称与有效期的会话认证。
+// store: 会话存储，为 nil 时使用 MemorySessionStore。
+func NewSession(store SessionStore) *Session {
+	if store == nil {
+		store = NewMemorySessionStore()
+	}
+	return &Session{Store: store, Cookie: DefaultSessionCookie, TTL: DefaultSessionTTL}
+}
+
+// Login 为用户创建会话并写入 Cookie。
+// 返回会话 ID。
+func (s *Session) Login(w http.ResponseWriter, principal *Principal) (string, error) {
+	buf := make([]byte, sessionIDBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(buf)
+	s.Store.Set(id, principal, s.ttl())
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.cookie(),
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int(s.ttl() / time.Second),
+		HttpOnly: true,
+		Secure:   s.Secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return id, nil
+}
+
+// Logout 删除当前请求的会话并清除 Cookie。
+func (s *Session) Logout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(s.cookie()); err == nil {
+		s.Store.Delete(cookie.Value)
+	}
+	http.SetCookie(w, &http.Cookie{Name: s.cookie(), Path: "/", MaxAge: -1, HttpOnly: true, Secure: s.Secure})
+}
+
+// Authenticate 实现 Authenticator 接口。
+func (s *Session) Authenticate(r *http.Request) (*Principal, error) {
+	cookie, err := r.Cookie(s.cookie())
+	if err != nil || cookie.Value == "" {
+		return nil, ErrNoCredentials
+	}
+	principal, ok := s.Store.Get(cookie.Value)
+	if !ok {
+		return nil, ErrSessionInvalid
+	}
+	return principal, nil
+}
+
+func (s *Session) cookie() string {
+	if s.Cookie == "" {
+		return DefaultSessionCookie
+	}
+	return s.Cookie
+}
+
+func (s *Session) ttl() time.Duration {
+	if s.TTL <= 0 {
+		return DefaultSessionTTL
+	}
+	return s.TTL
+}
+
+// MemorySessionStore 内存中的会话存储，适用于单实例部署。
+type MemorySessionStore struct {
+	mu        sync.Mutex
+	sessions  map[string]sessionEntry
+	nextSweep time.Time
+}
+
+type sessionEntry struct {
+	principal *Principal
+	expires   time.Time
+}
+
+// NewMemorySessionStore 创建内存会话存储。
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: map[string]sessionEntry{}}
+}
+
+// Get 实现 SessionStore 接口，过期的会话将被删除。
+func (m *MemorySessionStore) Get(id string) (*Principal, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.sessions[id]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(m.sessions, id)
+		return nil, false
+	}
+	return entry.principal, true
+}
+
+// Set 实现 SessionStore 接口，并定期清理过期的会话。
+func (m *MemorySessionStore) Set(id string, principal *Principal, ttl time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if now.After(m.nextSweep) {
+		for key, entry := range m.sessions {
+			if now.After(entry.expires) {
+				delete(m.sessions, key)
+			}
+		}
+		m.nextSweep = now.Add(sessionSweepInterval)
+	}
+	m.sessions[id] = sessionEntry{principal: principal, expires: now.Add(ttl)}
+}
+
+// Delete 实现 SessionStore 接口。
+func (m *MemorySessionStore) Delete(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+}
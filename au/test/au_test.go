@@ -0,0 +1,243 @@
+package au_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/QingShan-Xu/web/au"
+	"github.com/QingShan-Xu/web/bm"
+)
+
+// TestJWT 测试令牌的签发、校验与刷新
+func TestJWT(t *testing.T) {
+	j, err := au.NewJWT(au.JWTConfig{Secret: []byte("secret"), Issuer: "test"})
+	if err != nil {
+		t.Fatalf("NewJWT: %v", err)
+	}
+	pair, err := j.Issue(&au.Principal{ID: "1", TenantID: "t1", Roles: []string{"admin"}, Claims: map[string]interface{}{"dept": "rd"}})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	// 子测试 1：Authorization 头部中的访问令牌
+	t.Run("Authenticate", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+		principal, err := j.Authenticate(r)
+		if err != nil {
+			t.Fatalf("Authenticate: %v", err)
+		}
+		if principal.ID != "1" || principal.TenantID != "t1" || len(principal.Roles) != 1 || principal.Claims["dept"] != "rd" {
+			t.Errorf("Unexpected principal %+v", principal)
+		}
+	})
+
+	// 子测试 2：刷新令牌不能作为访问令牌使用
+	t.Run("RefreshTokenRejected", func(t *testing.T) {
+		if _, err := j.Parse(pair.RefreshToken, au.TokenAccess); !errors.Is(err, au.ErrTokenInvalid) {
+			t.Errorf("Expected ErrTokenInvalid, got %v", err)
+		}
+		if _, err := j.Refresh(pair.AccessToken); !errors.Is(err, au.ErrTokenInvalid) {
+			t.Errorf("Expected ErrTokenInvalid, got %v", err)
+		}
+	})
+
+	// 子测试 3：使用刷新令牌签发新的令牌
+	t.Run("Refresh", func(t *testing.T) {
+		refreshed, err := j.Refresh(pair.RefreshToken)
+		if err != nil {
+			t.Fatalf("Refresh: %v", err)
+		}
+		if principal, err := j.Parse(refreshed.AccessToken, au.TokenAccess); err != nil || principal.ID != "1" {
+			t.Errorf("Unexpected refreshed token: %+v, %v", principal, err)
+		}
+	})
+
+	// 子测试 4：其他密钥签发的令牌无效
+	t.Run("WrongKey", func(t *testing.T) {
+		other, _ := au.NewJWT(au.JWTConfig{Secret: []byte("other"), Issuer: "test"})
+		if _, err := other.Parse(pair.AccessToken, au.TokenAccess); !errors.Is(err, au.ErrTokenInvalid) {
+			t.Errorf("Expected ErrTokenInvalid, got %v", err)
+		}
+	})
+
+	// 子测试 5：没有令牌时交由下一个认证方式处理
+	t.Run("NoCredentials", func(t *testing.T) {
+		if _, err := j.Authenticate(httptest.NewRequest("GET", "/", nil)); !errors.Is(err, au.ErrNoCredentials) {
+			t.Errorf("Expected ErrNoCredentials, got %v", err)
+		}
+	})
+}
+
+// TestRBAC 测试角色与权限校验
+func TestRBAC(t *testing.T) {
+	store := au.NewMemoryRoleStore()
+	store.Grant("editor", "pet.*")
+	rbac := au.NewRBAC(store)
+	ctx := context.Background()
+	editor := &au.Principal{ID: "1", Roles: []string{"editor"}, Permissions: []string{"owner.read"}}
+
+	cases := []struct {
+		name        string
+		roles       []string
+		permissions []string
+		allowed     bool
+	}{
+		{"NoRequirement", nil, nil, true},
+		{"Role", []string{"admin", "editor"}, nil, true},
+		{"MissingRole", []string{"admin"}, nil, false},
+		{"WildcardPermission", nil, []string{"pet.delete"}, true},
+		{"OwnPermission", nil, []string{"pet.read", "owner.read"}, true},
+		{"MissingPermission", nil, []string{"pet.read", "owner.delete"}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := rbac.Authorize(ctx, editor, c.roles, c.permissions)
+			if c.allowed && err != nil {
+				t.Errorf("Expected allowed, got %v", err)
+			}
+			if !c.allowed && !errors.Is(err, bm.ErrForbidden) {
+				t.Errorf("Expected ErrForbidden, got %v", err)
+			}
+		})
+	}
+}
+
+// TestAPIKeys 测试 API Key 的查找、路由限制与配额
+func TestAPIKeys(t *testing.T) {
+	store := au.NewMemoryAPIKeyStore()
+	store.Add("secret", &au.APIKey{ID: "partner", ClientID: "c1", Routes: []string{"pet.*"}, RateLimit: 2})
+	keys := au.NewAPIKeys(store)
+
+	request := func(header, query string) *http.Request {
+		r := httptest.NewRequest("GET", "/?api_key="+query, nil)
+		r.Header.Set(au.APIKeyHeader, header)
+		return r
+	}
+
+	principal, err := keys.Authenticate(request("secret", ""))
+	if err != nil || principal.ID != "c1" {
+		t.Fatalf("Unexpected principal %+v, %v", principal, err)
+	}
+	if !principal.APIKey.Allows("pet.新建") || principal.APIKey.Allows("owner.list") {
+		t.Errorf("Unexpected route patterns %v", principal.APIKey.Routes)
+	}
+	if _, err := keys.Authenticate(request("", "secret")); err != nil {
+		t.Errorf("Expected key from query, got %v", err)
+	}
+	// 配额在 TakeQuota 时消耗，认证本身不消耗
+	for i := 0; i < 2; i++ {
+		if err := principal.TakeQuota(); err != nil {
+			t.Fatalf("TakeQuota %d: %v", i, err)
+		}
+	}
+	if err := principal.TakeQuota(); !errors.Is(err, au.ErrQuotaExceeded) {
+		t.Errorf("Expected ErrQuotaExceeded, got %v", err)
+	}
+	if err := (&au.Principal{ID: "1"}).TakeQuota(); err != nil {
+		t.Errorf("Expected no quota for non API Key principal, got %v", err)
+	}
+	if _, err := keys.Authenticate(request("other", "")); !errors.Is(err, au.ErrAPIKeyInvalid) {
+		t.Errorf("Expected ErrAPIKeyInvalid, got %v", err)
+	}
+	if _, err := keys.Authenticate(request("", "")); !errors.Is(err, au.ErrNoCredentials) {
+		t.Errorf("Expected ErrNoCredentials, got %v", err)
+	}
+}
+
+// TestSession 测试会话的创建、读取、过期与注销
+func TestSession(t *testing.T) {
+	store := au.NewMemorySessionStore()
+	session := au.NewSession(store)
+
+	// login 创建会话并返回带有 Cookie 的请求
+	login := func(t *testing.T, s *au.Session, principal *au.Principal) (string, *http.Request) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		id, err := s.Login(w, principal)
+		if err != nil {
+			t.Fatalf("Login: %v", err)
+		}
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].Name != au.DefaultSessionCookie || cookies[0].Value != id || !cookies[0].HttpOnly {
+			t.Fatalf("Unexpected cookies %+v", cookies)
+		}
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.AddCookie(cookies[0])
+		return id, r
+	}
+
+	// 子测试 1：登录后通过 Cookie 读取会话
+	t.Run("Login", func(t *testing.T) {
+		id, r := login(t, session, &au.Principal{ID: "1", TenantID: "t1"})
+		if principal, ok := store.Get(id); !ok || principal.ID != "1" {
+			t.Errorf("Expected stored session, got %+v %v", principal, ok)
+		}
+		if principal, err := session.Authenticate(r); err != nil || principal.ID != "1" || principal.TenantID != "t1" {
+			t.Errorf("Unexpected principal %+v, %v", principal, err)
+		}
+		if _, err := session.Authenticate(httptest.NewRequest(http.MethodGet, "/", nil)); !errors.Is(err, au.ErrNoCredentials) {
+			t.Errorf("Expected ErrNoCredentials without cookie, got %v", err)
+		}
+	})
+
+	// 子测试 2：过期的会话无效并从存储中删除
+	t.Run("Expired", func(t *testing.T) {
+		short := &au.Session{Store: store, TTL: 10 * time.Millisecond}
+		id, r := login(t, short, &au.Principal{ID: "2"})
+		time.Sleep(20 * time.Millisecond)
+		if _, err := short.Authenticate(r); !errors.Is(err, au.ErrSessionInvalid) {
+			t.Errorf("Expected ErrSessionInvalid, got %v", err)
+		}
+		if _, ok := store.Get(id); ok {
+			t.Errorf("Expected expired session to be removed")
+		}
+	})
+
+	// 子测试 3：注销后会话失效并清除 Cookie
+	t.Run("Logout", func(t *testing.T) {
+		id, r := login(t, session, &au.Principal{ID: "3"})
+		w := httptest.NewRecorder()
+		session.Logout(w, r)
+		if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].MaxAge != -1 {
+			t.Errorf("Expected cleared cookie, got %+v", cookies)
+		}
+		if _, ok := store.Get(id); ok {
+			t.Errorf("Expected session to be deleted")
+		}
+		if _, err := session.Authenticate(r); !errors.Is(err, au.ErrSessionInvalid) {
+			t.Errorf("Expected ErrSessionInvalid, got %v", err)
+		}
+	})
+
+	// 子测试 4：认证中间件通过 Cookie 识别用户
+	t.Run("Middleware", func(t *testing.T) {
+		var principal *au.Principal
+		var authErr error
+		handler := au.Middleware(session)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, _ = au.FromContext(r.Context())
+			authErr = au.ErrorFrom(r.Context())
+		}))
+
+		id, r := login(t, session, &au.Principal{ID: "4"})
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		if principal == nil || principal.ID != "4" || authErr != nil {
+			t.Errorf("Expected principal 4, got %+v, %v", principal, authErr)
+		}
+
+		store.Delete(id)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		if principal != nil || !errors.Is(authErr, au.ErrSessionInvalid) {
+			t.Errorf("Expected ErrSessionInvalid for revoked session, got %+v, %v", principal, authErr)
+		}
+
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		if principal != nil || !errors.Is(authErr, bm.ErrUnauthorized) {
+			t.Errorf("Expected ErrUnauthorized without cookie, got %+v, %v", principal, authErr)
+		}
+	})
+}
@@ -0,0 +1,82 @@
+package bm
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Config 定义了响应的全局配置。
+type Config struct {
+	RealStatus    bool   // 是否写入真实的 HTTP 状态码，关闭时始终写入 200
+	NoEnvelope    bool   // 是否去掉外层包装直接输出 Data，开启时总是写入真实状态码
+	Problem       bool   // 错误响应是否使用 RFC 7807 application/problem+json
+	CodeField     string // code 字段名，默认 "code"
+	ErrCodeField  string // 业务错误码字段名，默认 "error_code"
+	MsgField      string // msg 字段名，默认 "msg"
+	DataField     string // data 字段名，默认 "data"
+	CallbackField string // callback 字段名，默认 "callback"
+}
+
+var config = Config{}.withDefaults()
+
+// SetConfig 设置响应的全局配置，字段名为空时使用默认值。
+func SetConfig(cfg Config) {
+	config = cfg.withDefaults()
+}
+
+// GetConfig 返回当前的全局配置。
+func GetConfig() Config {
+	return config
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.CodeField == "" {
+		cfg.CodeField = "code"
+	}
+	if cfg.ErrCodeField == "" {
+		cfg.ErrCodeField = "error_code"
+	}
+	if cfg.MsgField == "" {
+		cfg.MsgField = "msg"
+	}
+	if cfg.DataField == "" {
+		cfg.DataField = "data"
+	}
+	if cfg.CallbackField == "" {
+		cfg.CallbackField = "callback"
+	}
+	return cfg
+}
+
+// envelopeMember 响应包装中的一个字段。
+type envelopeMember struct {
+	key   string
+	value interface{}
+}
+
+// envelope 保持字段顺序的响应包装。
+type envelope []envelopeMember
+
+// MarshalJSON 按字段顺序输出 JSON 对象。
+func (e envelope) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, member := range e {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(member.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(member.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,393 @@
+package bm
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ContentTypeXML         = "application/xml"
+	ContentTypeYAML        = "application/yaml"
+	ContentTypeMsgPack     = "application/msgpack"
+	ContentTypeProblemXML  = "application/problem+xml"
+	xmlRootElement         = "response"
+	xmlListItemElement     = "item"
+	defaultMediaType       = ContentTypeJSON
+	problemMediaTypePrefix = "application/problem+"
+)
+
+// browserMediaTypes 浏览器导航请求中排在首位的媒体类型，此时使用默认的 JSON。
+var browserMediaTypes = map[string]bool{
+	"text/html":             true,
+	"application/xhtml+xml": true,
+}
+
+// Encoder 响应体编码器。
+type Encoder interface {
+	Encode(w io.Writer, v interface{}) error
+}
+
+// EncoderFunc 函数形式的编码器。
+type EncoderFunc func(w io.Writer, v interface{}) error
+
+// Encode 实现 Encoder 接口。
+func (f EncoderFunc) Encode(w io.Writer, v interface{}) error {
+	return f(w, v)
+}
+
+// encoderEntry 已注册的编码器。
+type encoderEntry struct {
+	mediaType string
+	encoder   Encoder
+}
+
+var (
+	encoders   []encoderEntry
+	encodersMu sync.RWMutex
+)
+
+func init() {
+	RegisterEncoder(ContentTypeJSON, EncoderFunc(encodeJSON))
+	RegisterEncoder(ContentTypeXML, EncoderFunc(encodeXML))
+	RegisterEncoder("text/xml", EncoderFunc(encodeXML))
+	RegisterEncoder(ContentTypeYAML, EncoderFunc(encodeYAML))
+	RegisterEncoder("application/x-yaml", EncoderFunc(encodeYAML))
+	RegisterEncoder("text/yaml", EncoderFunc(encodeYAML))
+	RegisterEncoder(ContentTypeMsgPack, EncoderFunc(encodeMsgPack))
+	RegisterEncoder("application/x-msgpack", EncoderFunc(encodeMsgPack))
+	RegisterEncoder("application/vnd.msgpack", EncoderFunc(encodeMsgPack))
+}
+
+// RegisterEncoder 注册或替换指定媒体类型的编码器，Accept 为 */* 或缺失时使用 application/json。
+// mediaType: 媒体类型，例如 "application/xml"。
+// encoder: 编码器。
+func RegisterEncoder(mediaType string, encoder Encoder) {
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+
+	mediaType = strings.ToLower(mediaType)
+	for i, entry := range encoders {
+		if entry.mediaType == mediaType {
+			encoders[i].encoder = encoder
+			return
+		}
+	}
+	encoders = append(encoders, encoderEntry{mediaType: mediaType, encoder: encoder})
+}
+
+// acceptRange Accept 头部中的一个媒体范围。
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// negotiate 根据 Accept 头部选择编码器。
+// 其他格式只有在优先级严格高于 JSON 时才会被选择；优先级相同、通配符或浏览器以 HTML 优先的 Accept 均使用 JSON。
+// r: HTTP 请求，可为 nil。
+// 返回媒体类型、编码器以及是否匹配成功。
+func negotiate(r *http.Request) (string, Encoder, bool) {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+
+	accept := ""
+	if r != nil {
+		accept = r.Header.Get("Accept")
+	}
+	if strings.TrimSpace(accept) == "" {
+		return lookupEncoder(defaultMediaType)
+	}
+
+	ranges := parseAccept(accept)
+	defaultQ := acceptQuality(ranges, defaultMediaType)
+	// 浏览器的 Accept 以 text/html 开头，例如 text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8。
+	if len(ranges) > 0 && browserMediaTypes[ranges[0].mediaType] && defaultQ > 0 {
+		return lookupEncoder(defaultMediaType)
+	}
+
+	for _, candidate := range ranges {
+		mediaType, encoder, ok := matchEncoder(candidate.mediaType)
+		if !ok {
+			continue
+		}
+		if mediaType != defaultMediaType && candidate.q <= defaultQ {
+			return lookupEncoder(defaultMediaType)
+		}
+		return mediaType, encoder, true
+	}
+	return "", nil, false
+}
+
+// matchEncoder 查找与 Accept 中单个媒体范围匹配的编码器，调用方需持有读锁。
+// 通配符优先匹配默认的 JSON。
+func matchEncoder(mediaRange string) (string, Encoder, bool) {
+	switch {
+	case mediaRange == "*/*":
+		return lookupEncoder(defaultMediaType)
+	case strings.HasSuffix(mediaRange, "/*"):
+		prefix := strings.TrimSuffix(mediaRange, "*")
+		if strings.HasPrefix(defaultMediaType, prefix) {
+			return lookupEncoder(defaultMediaType)
+		}
+		for _, entry := range encoders {
+			if strings.HasPrefix(entry.mediaType, prefix) {
+				return entry.mediaType, entry.encoder, true
+			}
+		}
+	default:
+		if mediaType, encoder, ok := lookupEncoder(mediaRange); ok {
+			return mediaType, encoder, ok
+		}
+		// problem 的结构化语法后缀，例如 application/problem+json，其余后缀（如 application/xhtml+xml）不作回退。
+		if index := strings.LastIndex(mediaRange, "+"); index > 0 && strings.HasPrefix(mediaRange, problemMediaTypePrefix) {
+			return lookupEncoder("application/" + mediaRange[index+1:])
+		}
+	}
+	return "", nil, false
+}
+
+// acceptQuality 返回媒体类型在 Accept 中的 q 值，按完全匹配、type/* 与 */* 的顺序取最具体的一项，不接受时返回 0。
+func acceptQuality(ranges []acceptRange, mediaType string) float64 {
+	prefix := mediaType[:strings.Index(mediaType, "/")+1] + "*"
+	best, specificity := 0.0, 0
+	for _, candidate := range ranges {
+		current := 0
+		switch candidate.mediaType {
+		case mediaType:
+			current = 3
+		case prefix:
+			current = 2
+		case "*/*":
+			current = 1
+		}
+		if current > specificity {
+			best, specificity = candidate.q, current
+		}
+	}
+	return best
+}
+
+// defaultEncoder 返回默认的 JSON 编码器。
+func defaultEncoder() (string, Encoder, bool) {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+	return lookupEncoder(defaultMediaType)
+}
+
+// lookupEncoder 查找指定媒体类型的编码器，调用方需持有读锁。
+func lookupEncoder(mediaType string) (string, Encoder, bool) {
+	for _, entry := range encoders {
+		if entry.mediaType == mediaType {
+			return entry.mediaType, entry.encoder, true
+		}
+	}
+	return "", nil, false
+}
+
+// parseAccept 解析 Accept 头部，按 q 值从高到低排序，q=0 的项将被忽略。
+func parseAccept(accept string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		ranges = append(ranges, acceptRange{mediaType: mediaType, q: q})
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+	return ranges
+}
+
+// problemContentType 返回 problem 响应的 Content-Type。
+func problemContentType(mediaType string) string {
+	switch mediaType {
+	case ContentTypeJSON:
+		return ContentTypeProblemJSON
+	case ContentTypeXML, "text/xml":
+		return ContentTypeProblemXML
+	}
+	return mediaType
+}
+
+func encodeJSON(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func encodeXML(w io.Writer, v interface{}) error {
+	value, err := normalize(v)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	if err := writeXML(encoder, xmlRootElement, value); err != nil {
+		return err
+	}
+	return encoder.Flush()
+}
+
+func encodeYAML(w io.Writer, v interface{}) error {
+	value, err := normalize(v)
+	if err != nil {
+		return err
+	}
+	encoder := yaml.NewEncoder(w)
+	if err := encoder.Encode(value); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+func encodeMsgPack(w io.Writer, v interface{}) error {
+	value, err := normalize(v)
+	if err != nil {
+		return err
+	}
+	return msgpack.NewEncoder(w).Encode(value)
+}
+
+// normalize 将任意值转换为以 json 名称表示的通用结构，使各编码格式的字段名保持一致。
+// envelope 转换为 yaml.Node 与 msgpack 均能保持顺序的 orderedMap。
+func normalize(v interface{}) (interface{}, error) {
+	if e, ok := v.(envelope); ok {
+		result := make(orderedMap, 0, len(e))
+		for _, member := range e {
+			value, err := normalize(member.value)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, envelopeMember{member.key, value})
+		}
+		return result, nil
+	}
+
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return convertNumbers(value), nil
+}
+
+// convertNumbers 将 json.Number 转换为 int64 或 float64。
+func convertNumbers(v interface{}) interface{} {
+	switch value := v.(type) {
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i
+		}
+		f, _ := value.Float64()
+		return f
+	case map[string]interface{}:
+		for key, item := range value {
+			value[key] = convertNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = convertNumbers(item)
+		}
+	}
+	return v
+}
+
+// orderedMap 保持字段顺序的映射，用于 YAML 与 MessagePack 编码。
+type orderedMap []envelopeMember
+
+// MarshalYAML 实现 yaml.Marshaler 接口。
+func (m orderedMap) MarshalYAML() (interface{}, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for _, member := range m {
+		valueNode := &yaml.Node{}
+		if err := valueNode.Encode(member.value); err != nil {
+			return nil, err
+		}
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: member.key}, valueNode)
+	}
+	return node, nil
+}
+
+// EncodeMsgpack 实现 msgpack.CustomEncoder 接口。
+func (m orderedMap) EncodeMsgpack(encoder *msgpack.Encoder) error {
+	if err := encoder.EncodeMapLen(len(m)); err != nil {
+		return err
+	}
+	for _, member := range m {
+		if err := encoder.EncodeString(member.key); err != nil {
+			return err
+		}
+		if err := encoder.Encode(member.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeXML 以元素的形式写出经过 normalize 的值，映射按键排序，列表元素使用 item 元素。
+func writeXML(encoder *xml.Encoder, name string, value interface{}) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch data := value.(type) {
+	case orderedMap:
+		for _, member := range data {
+			if err := writeXML(encoder, member.key, member.value); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(data))
+		for key := range data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if err := writeXML(encoder, key, data[key]); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range data {
+			if err := writeXML(encoder, xmlListItemElement, item); err != nil {
+				return err
+			}
+		}
+	case nil:
+	default:
+		if err := encoder.EncodeToken(xml.CharData(fmt.Sprint(data))); err != nil {
+			return err
+		}
+	}
+
+	return encoder.EncodeToken(start.End())
+}
@@ -0,0 +1,188 @@
+package bm
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// Error 带有稳定业务错误码的错误，可直接交给 Res.Fail 渲染。
+type Error struct {
+	Code    string      // 业务错误码，例如 "pet.not_found"
+	Status  int         // HTTP 状态码
+	Key     string      // i18n 消息键
+	Msg     string      // 默认消息，没有翻译时使用
+	Details interface{} // 附加信息
+}
+
+// Translator 根据 i18n 消息键翻译错误消息。
+// key: 消息键。
+// r: 当前请求，可能为 nil，可用于读取 Accept-Language 等信息。
+// 返回翻译后的消息和是否翻译成功。
+type Translator func(key string, r *http.Request) (string, bool)
+
+// ErrorModule 按模块声明错误码，错误码自动加上模块前缀。
+type ErrorModule struct {
+	name string
+}
+
+var (
+	errorRegistry   = map[string]*Error{}
+	errorRegistryMu sync.RWMutex
+	translator      Translator
+)
+
+// 通用错误。
+var (
+	ErrBadRequest      = RegisterError(&Error{Code: "bad_request", Status: http.StatusBadRequest, Key: "error.bad_request", Msg: DefaultFailFrontendMessage})
+	ErrNotFound        = RegisterError(&Error{Code: "not_found", Status: http.StatusNotFound, Key: "error.not_found", Msg: "数据不存在"})
+	ErrInternal        = RegisterError(&Error{Code: "internal", Status: http.StatusInternalServerError, Key: "error.internal", Msg: DefaultFailBackendMessage})
+	ErrTimeout         = RegisterError(&Error{Code: "timeout", Status: http.StatusServiceUnavailable, Key: "error.timeout", Msg: "请求超时"})
+	ErrReadTimeout     = RegisterError(&Error{Code: "read_timeout", Status: http.StatusRequestTimeout, Key: "error.read_timeout", Msg: "读取请求超时"})
+	ErrBodyTooLarge    = RegisterError(&Error{Code: "body_too_large", Status: http.StatusRequestEntityTooLarge, Key: "error.body_too_large", Msg: "请求体过大"})
+	ErrUnauthorized    = RegisterError(&Error{Code: "unauthorized", Status: http.StatusUnauthorized, Key: "error.unauthorized", Msg: "未登录"})
+	ErrForbidden       = RegisterError(&Error{Code: "forbidden", Status: http.StatusForbidden, Key: "error.forbidden", Msg: "没有权限"})
+	ErrTooManyRequests = RegisterError(&Error{Code: "too_many_requests", Status: http.StatusTooManyRequests, Key: "error.too_many_requests", Msg: "请求过于频繁"})
+)
+
+// Error 实现 error 接口。
+func (e *Error) Error() string {
+	if e.Msg != "" {
+		return e.Msg
+	}
+	return e.Code
+}
+
+// Is 按错误码判断是否为同一错误，使 errors.Is 对 WithMsg/WithDetails 的副本同样生效。
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// WithMsg 返回替换了消息的副本。
+func (e *Error) WithMsg(msg ...interface{}) *Error {
+	clone := *e
+	clone.Msg = fmt.Sprint(msg...)
+	clone.Key = ""
+	return &clone
+}
+
+// WithDetails 返回带有附加信息的副本。
+func (e *Error) WithDetails(details interface{}) *Error {
+	clone := *e
+	clone.Details = details
+	return &clone
+}
+
+// message 返回翻译后的消息。
+func (e *Error) message(r *http.Request) string {
+	if translator != nil && e.Key != "" {
+		if msg, ok := translator(e.Key, r); ok {
+			return msg
+		}
+	}
+	if e.Msg != "" {
+		return e.Msg
+	}
+	return http.StatusText(e.Status)
+}
+
+// NewErrorModule 创建一个错误码模块。
+// name: 模块名称，作为错误码前缀。
+func NewErrorModule(name string) *ErrorModule {
+	return &ErrorModule{name: name}
+}
+
+// Define 在模块中声明并注册一个错误码。
+// code: 模块内的错误码，最终错误码为 "模块名.code"。
+// status: HTTP 状态码。
+// key: i18n 消息键。
+// msg: 默认消息。
+func (m *ErrorModule) Define(code string, status int, key, msg string) *Error {
+	return RegisterError(&Error{
+		Code:   m.name + "." + code,
+		Status: status,
+		Key:    key,
+		Msg:    msg,
+	})
+}
+
+// RegisterError 注册错误码，重复注册将 panic。
+func RegisterError(e *Error) *Error {
+	errorRegistryMu.Lock()
+	defer errorRegistryMu.Unlock()
+
+	if _, ok := errorRegistry[e.Code]; ok {
+		panic(fmt.Sprintf("bm: error code '%s' already registered", e.Code))
+	}
+	if e.Status == 0 {
+		e.Status = http.StatusInternalServerError
+	}
+	errorRegistry[e.Code] = e
+	return e
+}
+
+// LookupError 根据错误码查找已注册的错误。
+func LookupError(code string) (*Error, bool) {
+	errorRegistryMu.RLock()
+	defer errorRegistryMu.RUnlock()
+
+	e, ok := errorRegistry[code]
+	return e, ok
+}
+
+// RegisteredErrors 返回按错误码排序的全部已注册错误，可用于生成文档。
+func RegisteredErrors() []*Error {
+	errorRegistryMu.RLock()
+	defer errorRegistryMu.RUnlock()
+
+	list := make([]*Error, 0, len(errorRegistry))
+	for _, e := range errorRegistry {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Code < list[j].Code
+	})
+	return list
+}
+
+// SetTranslator 设置错误消息的翻译函数。
+func SetTranslator(t Translator) {
+	translator = t
+}
+
+// Fail 根据错误渲染失败响应，*Error（含包装后的）按其状态码与错误码输出，未设置状态码时使用 500，其余错误按后端错误处理。
+// err: 错误。
+func (r *Res) Fail(err error) *Res {
+	var e *Error
+	if !errors.As(err, &e) {
+		if err == nil {
+			return r.FailBackend()
+		}
+		return r.FailBackend(err)
+	}
+
+	r.Code = e.Status
+	if r.Code == 0 {
+		r.Code = http.StatusInternalServerError
+	}
+	r.Msg = e.message(r.req)
+	r.errCode = e.Code
+	r.details = e.Details
+	return r
+}
+
+// asError 检查消息参数是否为单个 *Error。
+func asError(msg []interface{}) (error, bool) {
+	if len(msg) != 1 {
+		return nil, false
+	}
+	err, ok := msg[0].(error)
+	if !ok {
+		return nil, false
+	}
+	var e *Error
+	return err, errors.As(err, &e)
+}
@@ -0,0 +1,103 @@
+package bm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 条件请求错误。
+var (
+	ErrPreconditionRequired = RegisterError(&Error{Code: "precondition_required", Status: http.StatusPreconditionRequired, Key: "error.precondition_required", Msg: "缺少 If-Match 请求头"})
+	ErrPreconditionFailed   = RegisterError(&Error{Code: "precondition_failed", Status: http.StatusPreconditionFailed, Key: "error.precondition_failed", Msg: "数据已被修改"})
+)
+
+// ETag 根据数据的 JSON 序列化结果生成强 ETag，响应时按编码格式区分，见 representationETag。
+// data: 数据。
+func ETag(data interface{}) (string, error) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+// ETagMatch 判断 If-Match 或 If-None-Match 头部是否匹配 etag，忽略弱标记 W/。
+// header: 请求头部的值，可以是 "*" 或逗号分隔的列表。
+// etag: 当前 ETag。
+func ETagMatch(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ETagMatchResource 与 ETagMatch 相同，但忽略响应编码的后缀，用于 If-Match 比较资源的当前状态。
+// header: 请求头部的值。
+// etag: 由 ETag 生成、不带编码后缀的 ETag。
+func ETagMatchResource(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if i := strings.LastIndex(candidate, "-"); i > 0 && strings.HasSuffix(candidate, `"`) {
+			candidate = candidate[:i] + `"`
+		}
+		if ETagMatch(candidate, etag) {
+			return true
+		}
+	}
+	return false
+}
+
+// representationETag 返回 etag 在 mediaType 编码下的值，默认的 JSON 保持不变，其他编码追加编码名称，
+// 使 JSON 与 XML 等不同编码的响应不共享 ETag。
+func representationETag(etag, mediaType string) string {
+	if etag == "" || mediaType == defaultMediaType {
+		return etag
+	}
+	return strings.TrimSuffix(etag, `"`) + "-" + mediaType[strings.LastIndex(mediaType, "/")+1:] + `"`
+}
+
+// WithETag 设置成功响应的 ETag，GET/HEAD 请求的 If-None-Match 匹配时返回 304。
+func (r *Res) WithETag(etag string) *Res {
+	r.etag = etag
+	return r
+}
+
+// WithLastModified 设置成功响应的 Last-Modified，没有 If-None-Match 时按 If-Modified-Since 返回 304。
+func (r *Res) WithLastModified(modTime time.Time) *Res {
+	r.lastModified = modTime
+	return r
+}
+
+// writeValidators 写入 ETag 与 Last-Modified 头部。
+func (r *Res) writeValidators() {
+	if r.etag != "" {
+		r.w.Header().Set("ETag", r.etag)
+	}
+	if !r.lastModified.IsZero() {
+		r.w.Header().Set("Last-Modified", r.lastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// notModified 判断是否应返回 304。
+func (r *Res) notModified() bool {
+	if r.req == nil || (r.req.Method != http.MethodGet && r.req.Method != http.MethodHead) {
+		return false
+	}
+	if header := r.req.Header.Get("If-None-Match"); header != "" {
+		return r.etag != "" && ETagMatch(header, r.etag)
+	}
+	if header := r.req.Header.Get("If-Modified-Since"); header != "" && !r.lastModified.IsZero() {
+		since, err := http.ParseTime(header)
+		return err == nil && !r.lastModified.Truncate(time.Second).After(since)
+	}
+	return false
+}
@@ -0,0 +1,177 @@
+package bm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ContentTypeEventStream = "text/event-stream"
+	LastEventIDHeader      = "Last-Event-ID"
+	LastEventIDQuery       = "lastEventId" // 不支持自定义头部的 EventSource 实现可通过查询参数传递
+	DefaultHeartbeat       = 15 * time.Second
+)
+
+// EventSink 向客户端推送 Server-Sent Events，可在多个 goroutine 中并发使用。
+type EventSink struct {
+	w           io.Writer
+	controller  *http.ResponseController
+	ctx         context.Context
+	lastEventID string
+	mu          sync.Mutex
+}
+
+// Send 推送一个事件。
+// event: 事件名称，为空时客户端按 message 事件处理。
+// data: 事件数据，string 与 []byte 原样发送，其余值编码为 JSON。
+func (s *EventSink) Send(event string, data interface{}) error {
+	return s.SendWithID("", event, data)
+}
+
+// SendWithID 推送一个带 ID 的事件，客户端重连时通过 Last-Event-ID 带回最后收到的 ID。
+// id: 事件 ID。
+// event: 事件名称。
+// data: 事件数据。
+func (s *EventSink) SendWithID(id, event string, data interface{}) error {
+	var payload string
+	switch value := data.(type) {
+	case string:
+		payload = value
+	case []byte:
+		payload = string(value)
+	default:
+		body, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		payload = string(body)
+	}
+
+	var b strings.Builder
+	if id != "" {
+		fmt.Fprintf(&b, "id: %s\n", id)
+	}
+	if event != "" {
+		fmt.Fprintf(&b, "event: %s\n", event)
+	}
+	for _, line := range strings.Split(payload, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+// Retry 设置客户端断线后的重连间隔。
+func (s *EventSink) Retry(d time.Duration) error {
+	return s.write(fmt.Sprintf("retry: %d\n\n", d.Milliseconds()))
+}
+
+// Comment 推送注释行，客户端会忽略该内容。
+func (s *EventSink) Comment(text string) error {
+	return s.write(": " + text + "\n\n")
+}
+
+// LastEventID 返回客户端重连时带回的最后事件 ID，首次连接为空。
+func (s *EventSink) LastEventID() string {
+	return s.lastEventID
+}
+
+// Done 返回客户端断开连接时关闭的通道。
+func (s *EventSink) Done() <-chan struct{} {
+	return s.ctx.Done()
+}
+
+// write 写出并立即刷新，客户端已断开时返回错误。
+func (s *EventSink) write(text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(s.w, text); err != nil {
+		return err
+	}
+	return s.controller.Flush()
+}
+
+// SucEvents 以 Server-Sent Events 的形式返回，连接在 stream 返回或客户端断开后结束。
+// heartbeat: 心跳间隔，小于等于 0 时使用 DefaultHeartbeat。
+// stream: 推送事件的函数，在 Send 时调用，应在 sink.Done() 关闭后尽快返回。
+func (r *Res) SucEvents(heartbeat time.Duration, stream func(sink *EventSink) error) *Res {
+	r.Code = http.StatusOK
+	r.heartbeat = heartbeat
+	r.eventStream = stream
+	r.Msg = DefaultSuccessMessage
+	return r
+}
+
+func (r *Res) sendEvents() {
+	if r.req == nil {
+		r.sendError(http.StatusInternalServerError, "event stream requires request")
+		return
+	}
+	heartbeat := r.heartbeat
+	if heartbeat <= 0 {
+		heartbeat = DefaultHeartbeat
+	}
+
+	lastEventID := r.req.Header.Get(LastEventIDHeader)
+	if lastEventID == "" {
+		lastEventID = r.req.URL.Query().Get(LastEventIDQuery)
+	}
+
+	// 返回前等待心跳结束，避免处理函数返回后仍写入响应。
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(r.req.Context())
+	defer wg.Wait()
+	defer cancel()
+
+	sink := &EventSink{
+		w:           r.w,
+		controller:  http.NewResponseController(r.w),
+		ctx:         ctx,
+		lastEventID: lastEventID,
+	}
+
+	r.w.Header().Set("Content-Type", ContentTypeEventStream)
+	r.w.Header().Set("Cache-Control", "no-cache")
+	r.w.Header().Set("Connection", "keep-alive")
+	r.w.Header().Set("X-Accel-Buffering", "no")
+	r.w.WriteHeader(http.StatusOK)
+	if err := sink.controller.Flush(); err != nil {
+		log.Printf("event stream: %v", err)
+		return
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := sink.Comment("ping"); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	// 响应头已写出，处理过程中的错误以 error 事件通知客户端。
+	if err := r.eventStream(sink); err != nil && ctx.Err() == nil {
+		log.Printf("event stream: %v", err)
+		sink.Send("error", err.Error())
+	}
+}
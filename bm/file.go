@@ -0,0 +1,209 @@
+package bm
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	DispositionAttachment = "attachment"
+	DispositionInline     = "inline"
+)
+
+// SucReader 以文件的形式返回 content 的内容，支持 Range 与 If-Modified-Since。
+// content: 文件内容。
+// hopeName: 文件名，同时用于推断 Content-Type。
+// modTime: 修改时间，零值时不处理 Last-Modified。
+func (r *Res) SucReader(content io.ReadSeeker, hopeName string, modTime time.Time, msg ...interface{}) *Res {
+	r.Code = http.StatusOK
+	r.content = content
+	r.hopeName = hopeName
+	r.modTime = modTime
+	r.Msg = formatMessage(msg, DefaultDownloadMessage)
+	return r
+}
+
+// SucBytes 以文件的形式返回 data。
+// data: 文件内容。
+// hopeName: 文件名，同时用于推断 Content-Type。
+func (r *Res) SucBytes(data []byte, hopeName string, msg ...interface{}) *Res {
+	return r.SucReader(bytes.NewReader(data), hopeName, time.Time{}, msg...)
+}
+
+// SucFS 以文件的形式返回 fsys 中的文件，例如 embed.FS。
+// fsys: 文件系统。
+// name: 文件在 fsys 中的路径。
+// hopeName: 下载文件名，为空时使用 name 的文件名部分。
+func (r *Res) SucFS(fsys fs.FS, name, hopeName string, msg ...interface{}) *Res {
+	r.Code = http.StatusOK
+	r.fsys = fsys
+	r.filePath = name
+	r.hopeName = hopeName
+	r.Msg = formatMessage(msg, DefaultDownloadMessage)
+	return r
+}
+
+// Inline 以 inline 方式返回文件，浏览器将直接展示而不是下载。
+func (r *Res) Inline() *Res {
+	r.disposition = DispositionInline
+	return r
+}
+
+// WithContentType 指定文件的 Content-Type，不指定时按文件名推断，无法推断时嗅探内容。
+func (r *Res) WithContentType(contentType string) *Res {
+	r.contentType = contentType
+	return r
+}
+
+// sendFile 返回 filePath 或 content 指定的文件。
+func (r *Res) sendFile() {
+	content, modTime := r.content, r.modTime
+	if content == nil {
+		file, info, err := r.openFile()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				r.failFile(ErrNotFound)
+			} else {
+				log.Printf("open file %s: %v", r.filePath, err)
+				r.failFile(ErrInternal)
+			}
+			return
+		}
+		defer file.Close()
+
+		seeker, ok := file.(io.ReadSeeker)
+		if !ok {
+			// 不支持 Seek 的文件（部分 fs.FS 实现）读入内存后返回。
+			data, err := io.ReadAll(file)
+			if err != nil {
+				log.Printf("read file %s: %v", r.filePath, err)
+				r.failFile(ErrInternal)
+				return
+			}
+			seeker = bytes.NewReader(data)
+		}
+		content, modTime = seeker, info.ModTime()
+		if r.hopeName == "" && r.fsys != nil {
+			r.hopeName = path.Base(r.filePath)
+		} else if r.hopeName == "" {
+			r.hopeName = filepath.Base(r.filePath)
+		}
+	}
+
+	r.writeFileHeaders()
+
+	req := r.req
+	if req == nil {
+		req = &http.Request{Method: http.MethodGet, Header: http.Header{}, URL: &url.URL{}}
+	}
+	// 未设置 Content-Type 时 ServeContent 按文件名推断或嗅探内容。
+	http.ServeContent(r.w, req, r.hopeName, modTime, content)
+}
+
+// openFile 打开 filePath 指定的普通文件。
+func (r *Res) openFile() (fs.File, fs.FileInfo, error) {
+	var file fs.File
+	var err error
+	if r.fsys != nil {
+		file, err = r.fsys.Open(r.filePath)
+	} else {
+		file, err = os.Open(r.filePath)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, nil, fs.ErrNotExist
+	}
+	return file, info, nil
+}
+
+// failFile 文件无法读取时改为返回错误响应。
+func (r *Res) failFile(err *Error) {
+	r.filePath, r.fsys, r.content = "", nil, nil
+	r.Fail(err)
+	r.sendData()
+}
+
+// writeFileHeaders 写入文件响应的公共头部。
+func (r *Res) writeFileHeaders() {
+	disposition := r.disposition
+	if disposition == "" {
+		disposition = DispositionAttachment
+	}
+	if disposition == DispositionAttachment {
+		r.w.Header().Set(ContentDescription, "File Transfer")
+		r.w.Header().Set(ContentTransferEncoding, "binary")
+	}
+	r.w.Header().Set(ContentDisposition, contentDisposition(disposition, r.hopeName))
+	if r.contentType != "" {
+		r.w.Header().Set("Content-Type", r.contentType)
+	}
+}
+
+// contentDisposition 生成 Content-Disposition 头部，非 ASCII 文件名按 RFC 5987 编码并附带 ASCII 回退文件名。
+// disposition: attachment 或 inline。
+// name: 文件名。
+func contentDisposition(disposition, name string) string {
+	if name == "" {
+		return disposition
+	}
+
+	var fallback strings.Builder
+	ascii := true
+	for _, c := range name {
+		switch {
+		case c >= utf8.RuneSelf:
+			ascii = false
+			fallback.WriteByte('_')
+		case c == '"' || c == '\\':
+			fallback.WriteByte('\\')
+			fallback.WriteRune(c)
+		case c < ' ' || c == 0x7f:
+			fallback.WriteByte('_')
+		default:
+			fallback.WriteRune(c)
+		}
+	}
+
+	value := disposition + `; filename="` + fallback.String() + `"`
+	if !ascii {
+		value += "; filename*=UTF-8''" + encodeRFC5987(name)
+	}
+	return value
+}
+
+// encodeRFC5987 按 RFC 5987 的 attr-char 规则百分号编码。
+func encodeRFC5987(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("!#$&+-.^_`|~", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&0x0f])
+	}
+	return b.String()
+}
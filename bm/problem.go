@@ -0,0 +1,80 @@
+package bm
+
+import (
+	"net/http"
+	"sort"
+)
+
+const (
+	ContentTypeProblemJSON = "application/problem+json"
+	ProblemTypeDefault     = "about:blank"
+	ProblemInvalidParams   = "invalid-params" // 参数校验错误的扩展字段名
+)
+
+// InvalidParam 参数校验错误，作为 problem+json 的 invalid-params 扩展字段输出。
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// WithProblem 覆盖全局配置，设置错误响应是否使用 RFC 7807 application/problem+json。
+func (r *Res) WithProblem(enabled bool) *Res {
+	r.problem = &enabled
+	return r
+}
+
+// Extend 添加 problem+json 的扩展字段，信封格式下忽略。
+// key: 扩展字段名。
+// value: 扩展字段值。
+func (r *Res) Extend(key string, value interface{}) *Res {
+	if r.extensions == nil {
+		r.extensions = map[string]interface{}{}
+	}
+	r.extensions[key] = value
+	return r
+}
+
+// isProblem 检查当前响应是否按 problem+json 输出。
+func (r *Res) isProblem() bool {
+	if r.Code < http.StatusBadRequest {
+		return false
+	}
+	if r.problem != nil {
+		return *r.problem
+	}
+	return config.Problem
+}
+
+// problemBody 生成 RFC 7807 格式的响应体。
+func (r *Res) problemBody() envelope {
+	title := http.StatusText(r.Code)
+	if title == "" {
+		title = r.Msg
+	}
+
+	body := envelope{
+		{"type", ProblemTypeDefault},
+		{"title", title},
+		{"status", r.Code},
+		{"detail", r.Msg},
+	}
+	if r.req != nil {
+		body = append(body, envelopeMember{"instance", r.req.URL.Path})
+	}
+	if r.errCode != "" {
+		body = append(body, envelopeMember{config.ErrCodeField, r.errCode})
+	}
+	if data := r.payload(); data != nil {
+		body = append(body, envelopeMember{config.DataField, data})
+	}
+
+	keys := make([]string, 0, len(r.extensions))
+	for key := range r.extensions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		body = append(body, envelopeMember{key, r.extensions[key]})
+	}
+	return body
+}
@@ -0,0 +1,32 @@
+package bm
+
+import "net/http"
+
+// SucRaw 原样返回已编码的响应，例如缓存的响应，If-None-Match 匹配 header 中的 ETag 时返回 304。
+// status: HTTP 状态码。
+// header: 响应头部，会复制到响应中。
+// body: 响应体。
+func (r *Res) SucRaw(status int, header http.Header, body []byte) *Res {
+	r.Code = status
+	r.rawHeader = header
+	r.rawBody = body
+	r.raw = true
+	return r
+}
+
+func (r *Res) sendRaw() {
+	for key, values := range r.rawHeader {
+		r.w.Header()[key] = append([]string(nil), values...)
+	}
+
+	if etag := r.rawHeader.Get("ETag"); etag != "" && r.req != nil {
+		if header := r.req.Header.Get("If-None-Match"); header != "" && ETagMatch(header, etag) {
+			r.w.Header().Del("Content-Length")
+			r.w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	r.w.WriteHeader(r.Code)
+	r.w.Write(r.rawBody)
+}
@@ -1,9 +1,13 @@
 package bm
 
 import (
-	"encoding/json"
+	"bytes"
 	"fmt"
+	"io"
+	"io/fs"
+	"log"
 	"net/http"
+	"time"
 )
 
 type Res struct {
@@ -12,9 +16,32 @@ type Res struct {
 	Msg      string      `json:"msg"`
 	Callback string      `json:"callback"`
 
-	filePath string              `json:"-"`
-	hopeName string              `json:"-"`
-	w        http.ResponseWriter `json:"-"`
+	filePath     string                                       `json:"-"`
+	hopeName     string                                       `json:"-"`
+	contentType  string                                       `json:"-"`
+	fileWriter   func(w io.Writer) error                      `json:"-"`
+	streamRows   func(emit func(row interface{}) error) error `json:"-"`
+	streamFormat StreamFormat                                 `json:"-"`
+	eventStream  func(sink *EventSink) error                  `json:"-"`
+	heartbeat    time.Duration                                `json:"-"`
+	upgraded     bool                                         `json:"-"`
+	content      io.ReadSeeker                                `json:"-"`
+	fsys         fs.FS                                        `json:"-"`
+	modTime      time.Time                                    `json:"-"`
+	disposition  string                                       `json:"-"`
+	etag         string                                       `json:"-"`
+	lastModified time.Time                                    `json:"-"`
+	raw          bool                                         `json:"-"`
+	rawHeader    http.Header                                  `json:"-"`
+	rawBody      []byte                                       `json:"-"`
+	realStatus   *bool                                        `json:"-"`
+	noEnvelope   *bool                                        `json:"-"`
+	problem      *bool                                        `json:"-"`
+	extensions   map[string]interface{}                       `json:"-"`
+	errCode      string                                       `json:"-"`
+	details      interface{}                                  `json:"-"`
+	req          *http.Request                                `json:"-"`
+	w            http.ResponseWriter                          `json:"-"`
 }
 
 type ResList struct {
@@ -23,9 +50,25 @@ type ResList struct {
 	Total int64       `json:"total"`
 }
 
+// ImportReport 批量导入的结果报告。
+type ImportReport struct {
+	Total   int              `json:"total"`
+	Success int              `json:"success"`
+	Errors  []ImportRowError `json:"errors"`
+}
+
+// ImportRowError 导入时单行单列的错误。
+type ImportRowError struct {
+	Row    int    `json:"row"`
+	Column string `json:"column"`
+	Msg    string `json:"msg"`
+}
+
 const (
 	ContentTypeJSON            = "application/json"
 	ContentTypeOctetStream     = "application/octet-stream"
+	ContentTypeCSV             = "text/csv; charset=utf-8"
+	ContentTypeXLSX            = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
 	ContentDescription         = "Content-Description"
 	ContentTransferEncoding    = "Content-Transfer-Encoding"
 	ContentDisposition         = "Content-Disposition"
@@ -39,6 +82,25 @@ func NewRes(w http.ResponseWriter) *Res {
 	return &Res{w: w}
 }
 
+// WithRequest 关联当前请求，用于生成 problem+json 的 instance 等需要请求信息的场景。
+func (r *Res) WithRequest(req *http.Request) *Res {
+	r.req = req
+	return r
+}
+
+// WithRealStatus 覆盖全局配置，设置是否写入真实的 HTTP 状态码。
+func (r *Res) WithRealStatus(enabled bool) *Res {
+	r.realStatus = &enabled
+	return r
+}
+
+// WithEnvelope 覆盖全局配置，设置是否输出 code/msg/data 外层包装。
+func (r *Res) WithEnvelope(enabled bool) *Res {
+	noEnvelope := !enabled
+	r.noEnvelope = &noEnvelope
+	return r
+}
+
 func (r *Res) SucJson(data interface{}, msg ...interface{}) *Res {
 	r.Code = http.StatusOK
 	r.Data = data
@@ -54,6 +116,26 @@ func (r *Res) SucFile(filePath, hopeName string, msg ...interface{}) *Res {
 	return r
 }
 
+// SucFileWriter 以文件下载的形式返回由 write 写出的内容，适用于导出等无需落盘的场景。
+// hopeName: 下载文件名。
+// contentType: 文件的 Content-Type。
+// write: 写出文件内容的函数，在 Send 时调用。
+func (r *Res) SucFileWriter(hopeName, contentType string, write func(w io.Writer) error, msg ...interface{}) *Res {
+	r.Code = http.StatusOK
+	r.hopeName = hopeName
+	r.contentType = contentType
+	r.fileWriter = write
+	r.Msg = formatMessage(msg, DefaultDownloadMessage)
+	return r
+}
+
+// SucUpgrade 表示连接已被升级或接管（例如 WebSocket），Send 不再写出任何内容。
+func (r *Res) SucUpgrade() *Res {
+	r.Code = http.StatusSwitchingProtocols
+	r.upgraded = true
+	return r
+}
+
 func (r *Res) SucList(data ResList, msg ...interface{}) *Res {
 	r.Code = http.StatusOK
 	r.Data = data
@@ -62,26 +144,43 @@ func (r *Res) SucList(data ResList, msg ...interface{}) *Res {
 }
 
 func (r *Res) FailBackend(msg ...interface{}) *Res {
+	if err, ok := asError(msg); ok {
+		return r.Fail(err)
+	}
 	r.Code = http.StatusInternalServerError
 	r.Msg = formatMessage(msg, DefaultFailBackendMessage)
 	return r
 }
 
 func (r *Res) FailFront(msg ...interface{}) *Res {
+	if err, ok := asError(msg); ok {
+		return r.Fail(err)
+	}
 	r.Code = http.StatusBadRequest
 	r.Msg = formatMessage(msg, DefaultFailFrontendMessage)
 	return r
 }
 func (r *Res) Send() {
+	if r.upgraded {
+		return
+	}
 	if r.Code == 0 {
 		r.sendError(http.StatusInternalServerError, "Internal Server Error")
 		return
 	}
 
-	if r.filePath != "" {
+	if r.raw {
+		r.sendRaw()
+	} else if r.eventStream != nil {
+		r.sendEvents()
+	} else if r.streamRows != nil {
+		r.sendStream()
+	} else if r.fileWriter != nil {
+		r.sendFileWriter()
+	} else if r.filePath != "" || r.content != nil {
 		r.sendFile()
 	} else {
-		r.sendJSON()
+		r.sendData()
 	}
 }
 
@@ -89,23 +188,102 @@ func (r *Res) sendError(status int, message string) {
 	http.Error(r.w, message, status)
 }
 
-func (r *Res) sendFile() {
-	if r.hopeName == "" {
-		r.hopeName = r.filePath
+func (r *Res) sendFileWriter() {
+	if r.contentType == "" {
+		r.contentType = ContentTypeOctetStream
+	}
+	r.writeFileHeaders()
+	r.w.WriteHeader(http.StatusOK)
+
+	// 响应头已写出，写出过程中的错误只能记录。
+	if err := r.fileWriter(r.w); err != nil {
+		log.Printf("write file %s: %v", r.hopeName, err)
+	}
+}
+
+func (r *Res) sendData() {
+	mediaType, encoder, ok := negotiate(r.req)
+	// 失败的响应不因 Accept 无法满足而变为 406，例如 text/event-stream 或 text/csv 路由的 401 与 400。
+	if !ok && r.Code >= http.StatusBadRequest {
+		mediaType, encoder, ok = defaultEncoder()
+	}
+	if !ok {
+		r.sendError(http.StatusNotAcceptable, http.StatusText(http.StatusNotAcceptable))
+		return
+	}
+
+	if r.Code < http.StatusBadRequest {
+		r.etag = representationETag(r.etag, mediaType)
+		r.writeValidators()
+		if r.notModified() {
+			r.w.Header().Add("Vary", "Accept")
+			r.w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	contentType, status, body := mediaType, r.Code, interface{}(nil)
+	if r.isProblem() {
+		contentType = problemContentType(mediaType)
+		body = r.problemBody()
+	} else {
+		noEnvelope := config.NoEnvelope
+		if r.noEnvelope != nil {
+			noEnvelope = *r.noEnvelope
+		}
+		realStatus := config.RealStatus
+		if r.realStatus != nil {
+			realStatus = *r.realStatus
+		}
+
+		// 没有外层包装时只能通过状态码区分错误。
+		if !realStatus && !noEnvelope {
+			status = http.StatusOK
+		}
+		body = r.body(noEnvelope)
 	}
 
-	r.w.Header().Set(ContentDescription, "File Transfer")
-	r.w.Header().Set(ContentTransferEncoding, "binary")
-	r.w.Header().Set(ContentDisposition, "attachment; filename="+r.hopeName)
-	r.w.Header().Set("Content-Type", ContentTypeOctetStream)
+	// 先编码到缓冲区，编码失败时仍可返回错误状态码。
+	var buf bytes.Buffer
+	if err := encoder.Encode(&buf, body); err != nil {
+		r.sendError(http.StatusInternalServerError, fmt.Sprintf("encode response as %s: %v", mediaType, err))
+		return
+	}
 
-	http.ServeFile(r.w, nil, r.filePath)
+	r.w.Header().Set("Content-Type", contentType)
+	r.w.Header().Add("Vary", "Accept")
+	r.w.WriteHeader(status)
+	r.w.Write(buf.Bytes())
 }
 
-func (r *Res) sendJSON() {
-	r.w.Header().Set("Content-Type", ContentTypeJSON)
-	r.w.WriteHeader(200)
-	json.NewEncoder(r.w).Encode(r)
+// body 按配置生成响应体。
+func (r *Res) body(noEnvelope bool) interface{} {
+	if noEnvelope {
+		if r.Code >= http.StatusBadRequest && r.Data == nil {
+			body := envelope{}
+			if r.errCode != "" {
+				body = append(body, envelopeMember{config.ErrCodeField, r.errCode})
+			}
+			body = append(body, envelopeMember{config.MsgField, r.Msg})
+			if r.details != nil {
+				body = append(body, envelopeMember{config.DataField, r.details})
+			}
+			return body
+		}
+		return r.Data
+	}
+
+	body := envelope{{config.CodeField, r.Code}}
+	if r.errCode != "" {
+		body = append(body, envelopeMember{config.ErrCodeField, r.errCode})
+	}
+	if data := r.payload(); data != nil {
+		body = append(body, envelopeMember{config.DataField, data})
+	}
+	return append(body,
+		envelopeMember{config.MsgField, r.Msg},
+		envelopeMember{config.CallbackField, r.Callback},
+	)
 }
 
 func formatMessage(msg []interface{}, defaultMsg string) string {
@@ -114,3 +292,11 @@ func formatMessage(msg []interface{}, defaultMsg string) string {
 	}
 	return fmt.Sprint(msg...)
 }
+
+// payload 返回 data 字段的内容，失败响应没有数据时使用错误的附加信息。
+func (r *Res) payload() interface{} {
+	if r.Data == nil && r.details != nil {
+		return r.details
+	}
+	return r.Data
+}
@@ -0,0 +1,71 @@
+package bm
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+)
+
+// StreamFormat 流式响应的输出格式。
+type StreamFormat string
+
+const (
+	StreamNDJSON      StreamFormat = "ndjson" // 每行一个 JSON 对象
+	StreamJSONArray   StreamFormat = "json"   // 逐个写出元素的 JSON 数组
+	ContentTypeNDJSON              = "application/x-ndjson"
+	StreamFlushEvery               = 100 // 每写出多少行刷新一次
+)
+
+// SucStream 以流式方式返回行数据，不经过外层包装，内存占用与结果大小无关。
+// format: 输出格式。
+// rows: 产生行数据的函数，对每一行调用 emit，在 Send 时调用。
+func (r *Res) SucStream(format StreamFormat, rows func(emit func(row interface{}) error) error, msg ...interface{}) *Res {
+	r.Code = http.StatusOK
+	r.streamFormat = format
+	r.streamRows = rows
+	r.Msg = formatMessage(msg, DefaultSuccessMessage)
+	return r
+}
+
+func (r *Res) sendStream() {
+	contentType := ContentTypeJSON
+	if r.streamFormat == StreamNDJSON {
+		contentType = ContentTypeNDJSON
+	}
+	r.w.Header().Set("Content-Type", contentType)
+	r.w.Header().Set("X-Content-Type-Options", "nosniff")
+	r.w.WriteHeader(http.StatusOK)
+
+	controller := http.NewResponseController(r.w)
+	encoder := json.NewEncoder(r.w)
+	count := 0
+
+	if r.streamFormat != StreamNDJSON {
+		io.WriteString(r.w, "[")
+	}
+	err := r.streamRows(func(row interface{}) error {
+		if r.streamFormat != StreamNDJSON && count > 0 {
+			if _, err := io.WriteString(r.w, ","); err != nil {
+				return err
+			}
+		}
+		if err := encoder.Encode(row); err != nil {
+			return err
+		}
+		count++
+		if count%StreamFlushEvery == 0 {
+			controller.Flush()
+		}
+		return nil
+	})
+	// 响应头已写出，出错时停止写出，未闭合的数组可让客户端感知失败。
+	if err != nil {
+		log.Printf("write stream: %v", err)
+		return
+	}
+	if r.streamFormat != StreamNDJSON {
+		io.WriteString(r.w, "]\n")
+	}
+	controller.Flush()
+}
@@ -0,0 +1,339 @@
+package bm_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QingShan-Xu/web/bm"
+)
+
+// TestRes_Envelope 测试响应包装与状态码配置
+func TestRes_Envelope(t *testing.T) {
+	defer bm.SetConfig(bm.Config{})
+
+	// 子测试 1：默认配置下错误也写入 200
+	t.Run("DefaultStatus", func(t *testing.T) {
+		bm.SetConfig(bm.Config{})
+		w := httptest.NewRecorder()
+		bm.NewRes(w).FailFront("参数错误").Send()
+
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", w.Code)
+		}
+		expected := `{"code":400,"msg":"参数错误","callback":""}`
+		if body := strings.TrimSpace(w.Body.String()); body != expected {
+			t.Errorf("Expected body %s, got %s", expected, body)
+		}
+	})
+
+	// 子测试 2：开启 RealStatus 后写入真实状态码
+	t.Run("RealStatus", func(t *testing.T) {
+		bm.SetConfig(bm.Config{RealStatus: true})
+		w := httptest.NewRecorder()
+		bm.NewRes(w).FailBackend().Send()
+
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("Expected status 500, got %d", w.Code)
+		}
+	})
+
+	// 子测试 3：单个响应覆盖全局配置
+	t.Run("PerResOverride", func(t *testing.T) {
+		bm.SetConfig(bm.Config{RealStatus: true})
+		w := httptest.NewRecorder()
+		bm.NewRes(w).WithRealStatus(false).FailFront().Send()
+
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", w.Code)
+		}
+	})
+
+	// 子测试 4：自定义字段名
+	t.Run("CustomFields", func(t *testing.T) {
+		bm.SetConfig(bm.Config{CodeField: "status", MsgField: "message", DataField: "result"})
+		w := httptest.NewRecorder()
+		bm.NewRes(w).SucJson(map[string]int{"id": 1}, "ok").Send()
+
+		expected := `{"status":200,"result":{"id":1},"message":"ok","callback":""}`
+		if body := strings.TrimSpace(w.Body.String()); body != expected {
+			t.Errorf("Expected body %s, got %s", expected, body)
+		}
+	})
+
+	// 子测试 5：去掉外层包装
+	t.Run("NoEnvelope", func(t *testing.T) {
+		bm.SetConfig(bm.Config{NoEnvelope: true})
+		w := httptest.NewRecorder()
+		bm.NewRes(w).SucJson(map[string]int{"id": 1}).Send()
+
+		if body := strings.TrimSpace(w.Body.String()); body != `{"id":1}` {
+			t.Errorf("Expected bare data, got %s", body)
+		}
+
+		w = httptest.NewRecorder()
+		bm.NewRes(w).FailFront("参数错误").Send()
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", w.Code)
+		}
+		if body := strings.TrimSpace(w.Body.String()); body != `{"msg":"参数错误"}` {
+			t.Errorf("Expected message body, got %s", body)
+		}
+	})
+}
+
+// TestRes_Problem 测试 RFC 7807 错误响应
+func TestRes_Problem(t *testing.T) {
+	defer bm.SetConfig(bm.Config{})
+	bm.SetConfig(bm.Config{Problem: true})
+
+	// 子测试 1：错误按 problem+json 输出
+	t.Run("Error", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/pet", nil)
+		bm.NewRes(w).WithRequest(req).
+			Extend(bm.ProblemInvalidParams, []bm.InvalidParam{{Name: "name", Reason: "name为必填字段"}}).
+			FailFront("name为必填字段").
+			Send()
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", w.Code)
+		}
+		if contentType := w.Header().Get("Content-Type"); contentType != bm.ContentTypeProblemJSON {
+			t.Errorf("Expected Content-Type %s, got %s", bm.ContentTypeProblemJSON, contentType)
+		}
+		expected := `{"type":"about:blank","title":"Bad Request","status":400,"detail":"name为必填字段","instance":"/pet","invalid-params":[{"name":"name","reason":"name为必填字段"}]}`
+		if body := strings.TrimSpace(w.Body.String()); body != expected {
+			t.Errorf("Expected body %s, got %s", expected, body)
+		}
+	})
+
+	// 子测试 2：成功响应保持信封格式
+	t.Run("Success", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		bm.NewRes(w).SucJson(nil).Send()
+
+		if contentType := w.Header().Get("Content-Type"); contentType != bm.ContentTypeJSON {
+			t.Errorf("Expected Content-Type %s, got %s", bm.ContentTypeJSON, contentType)
+		}
+	})
+}
+
+// 错误码只能注册一次，测试使用的错误在包级别定义
+var (
+	petErrors      = bm.NewErrorModule("pet_test")
+	errPetNotFound = petErrors.Define("not_found", http.StatusNotFound, "pet.not_found", "宠物不存在")
+)
+
+// TestRes_Error 测试业务错误码的渲染
+func TestRes_Error(t *testing.T) {
+	defer bm.SetConfig(bm.Config{})
+	defer bm.SetTranslator(nil)
+
+	// 子测试 1：包装后的错误按错误码渲染
+	t.Run("Wrapped", func(t *testing.T) {
+		bm.SetConfig(bm.Config{RealStatus: true})
+		w := httptest.NewRecorder()
+		err := fmt.Errorf("find pet: %w", errPetNotFound.WithDetails(map[string]int{"id": 1}))
+		bm.NewRes(w).FailFront(err).Send()
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404, got %d", w.Code)
+		}
+		expected := `{"code":404,"error_code":"pet_test.not_found","data":{"id":1},"msg":"宠物不存在","callback":""}`
+		if body := strings.TrimSpace(w.Body.String()); body != expected {
+			t.Errorf("Expected body %s, got %s", expected, body)
+		}
+		if !errors.Is(err, errPetNotFound) {
+			t.Errorf("Expected errors.Is to match copies of the registered error")
+		}
+	})
+
+	// 子测试 2：消息键翻译
+	t.Run("Translate", func(t *testing.T) {
+		bm.SetConfig(bm.Config{})
+		bm.SetTranslator(func(key string, r *http.Request) (string, bool) {
+			return "pet not found", key == "pet.not_found"
+		})
+		w := httptest.NewRecorder()
+		bm.NewRes(w).Fail(errPetNotFound).Send()
+
+		if !strings.Contains(w.Body.String(), `"msg":"pet not found"`) {
+			t.Errorf("Expected translated message, got %s", w.Body.String())
+		}
+	})
+
+	// 子测试 3：重复注册
+	t.Run("Duplicate", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Expected panic on duplicate error code")
+			}
+		}()
+		petErrors.Define("not_found", http.StatusNotFound, "", "")
+	})
+
+	// 子测试 4：未注册且没有状态码的错误按 500 渲染
+	t.Run("ZeroStatus", func(t *testing.T) {
+		bm.SetConfig(bm.Config{RealStatus: true})
+		w := httptest.NewRecorder()
+		bm.NewRes(w).Fail(&bm.Error{Code: "pet_test.unknown", Msg: "未知错误"}).Send()
+
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("Expected status 500, got %d", w.Code)
+		}
+		if contentType := w.Header().Get("Content-Type"); contentType != bm.ContentTypeJSON {
+			t.Errorf("Expected JSON body, got %s", contentType)
+		}
+	})
+
+	if e, ok := bm.LookupError("pet_test.not_found"); !ok || e != errPetNotFound {
+		t.Errorf("Expected registered error to be found")
+	}
+}
+
+// TestRes_Negotiation 测试基于 Accept 头部的内容协商
+func TestRes_Negotiation(t *testing.T) {
+	data := map[string]interface{}{"id": 1, "name": "cat"}
+
+	send := func(accept string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/pet/1", nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		bm.NewRes(w).WithRequest(req).SucJson(data, "ok").Send()
+		return w
+	}
+
+	cases := []struct {
+		accept      string
+		contentType string
+		contains    string
+	}{
+		{"", bm.ContentTypeJSON, `"data":{"id":1,"name":"cat"}`},
+		{"*/*", bm.ContentTypeJSON, `"code":200`},
+		{"application/xml", bm.ContentTypeXML, "<data><id>1</id><name>cat</name></data>"},
+		{"text/html;q=0.9, application/yaml", bm.ContentTypeYAML, "name: cat"},
+		{"application/msgpack", bm.ContentTypeMsgPack, "cat"},
+		{"application/problem+json", bm.ContentTypeJSON, `"msg":"ok"`},
+		{"application/problem+xml", bm.ContentTypeXML, "<msg>ok</msg>"},
+		{"text/html,application/xhtml+xml,*/*;q=0.8", bm.ContentTypeJSON, `"msg":"ok"`},
+		// 浏览器导航请求的 Accept
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7", bm.ContentTypeJSON, `"msg":"ok"`},
+		{"application/xml, application/json", bm.ContentTypeJSON, `"msg":"ok"`},
+		{"application/xml, */*", bm.ContentTypeJSON, `"msg":"ok"`},
+		{"application/xml, application/json;q=0.5", bm.ContentTypeXML, "<msg>ok</msg>"},
+	}
+	for _, c := range cases {
+		w := send(c.accept)
+		if contentType := w.Header().Get("Content-Type"); contentType != c.contentType {
+			t.Errorf("Accept %q: expected Content-Type %s, got %s", c.accept, c.contentType, contentType)
+		}
+		if !strings.Contains(w.Body.String(), c.contains) {
+			t.Errorf("Accept %q: expected body to contain %s, got %s", c.accept, c.contains, w.Body.String())
+		}
+	}
+
+	// 没有可用的编码器时返回 406
+	if w := send("text/html"); w.Code != http.StatusNotAcceptable {
+		t.Errorf("Expected status 406, got %d", w.Code)
+	}
+
+	// 失败的响应使用 JSON 并保留状态码
+	for _, accept := range []string{"text/event-stream", "text/csv"} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/pet/1", nil)
+		req.Header.Set("Accept", accept)
+		bm.NewRes(w).WithRequest(req).WithRealStatus(true).Fail(bm.ErrUnauthorized).Send()
+		if w.Code != http.StatusUnauthorized || w.Header().Get("Content-Type") != bm.ContentTypeJSON {
+			t.Errorf("Accept %q: expected JSON 401, got %d %s", accept, w.Code, w.Header().Get("Content-Type"))
+		}
+	}
+}
+
+// TestRes_File 测试文件响应
+func TestRes_File(t *testing.T) {
+	// 子测试 1：中文文件名按 RFC 5987 编码
+	t.Run("UnicodeFilename", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		bm.NewRes(w).WithRequest(r).SucBytes([]byte("a,b\n"), "报表.csv").Send()
+
+		expected := `attachment; filename="__.csv"; filename*=UTF-8''%E6%8A%A5%E8%A1%A8.csv`
+		if disposition := w.Header().Get(bm.ContentDisposition); disposition != expected {
+			t.Errorf("Expected disposition %s, got %s", expected, disposition)
+		}
+		if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/csv") {
+			t.Errorf("Expected text/csv, got %s", contentType)
+		}
+	})
+
+	// 子测试 2：Range 请求返回部分内容
+	t.Run("Range", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Range", "bytes=2-4")
+		bm.NewRes(w).WithRequest(r).Inline().SucBytes([]byte("0123456789"), "a.txt").Send()
+
+		if w.Code != http.StatusPartialContent {
+			t.Errorf("Expected status 206, got %d", w.Code)
+		}
+		if body := w.Body.String(); body != "234" {
+			t.Errorf("Expected body 234, got %s", body)
+		}
+		if disposition := w.Header().Get(bm.ContentDisposition); disposition != `inline; filename="a.txt"` {
+			t.Errorf("Unexpected disposition %s", disposition)
+		}
+	})
+
+	// 子测试 3：文件不存在时返回 404
+	t.Run("NotFound", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		bm.NewRes(w).WithRequest(r).WithRealStatus(true).SucFile("not-exist.txt", "").Send()
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404, got %d", w.Code)
+		}
+	})
+}
+
+// TestRes_ETag 测试条件请求
+func TestRes_ETag(t *testing.T) {
+	data := map[string]int{"id": 1}
+	etag, err := bm.ETag(data)
+	if err != nil {
+		t.Fatalf("ETag failed: %v", err)
+	}
+
+	// 子测试 1：If-None-Match 匹配时返回 304
+	t.Run("NotModified", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("If-None-Match", `W/"other", `+etag)
+		bm.NewRes(w).WithRequest(r).WithETag(etag).SucJson(data).Send()
+
+		if w.Code != http.StatusNotModified {
+			t.Errorf("Expected status 304, got %d", w.Code)
+		}
+		if w.Body.Len() != 0 {
+			t.Errorf("Expected empty body, got %s", w.Body.String())
+		}
+	})
+
+	// 子测试 2：不匹配时返回数据与 ETag
+	t.Run("Modified", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("If-None-Match", `"other"`)
+		bm.NewRes(w).WithRequest(r).WithETag(etag).SucJson(data).Send()
+
+		if w.Code != http.StatusOK || w.Header().Get("ETag") != etag {
+			t.Errorf("Expected status 200 with ETag %s, got %d %s", etag, w.Code, w.Header().Get("ETag"))
+		}
+	})
+}
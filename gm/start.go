@@ -34,7 +34,7 @@ func Start(
 		port = ":" + port
 	}
 
-	initDoc(r)
+	initDoc(r, router)
 
 	// 启动
 	fmt.Printf("Server started at %s\n", port)
@@ -43,7 +43,7 @@ func Start(
 	}
 }
 
-func initDoc(r *chi.Mux) {
+func initDoc(r *chi.Mux, router *rt.Router) {
 	relativePath := viper.GetString("Doc.RelativePath")
 	if relativePath == "" {
 		return
@@ -60,8 +60,24 @@ func initDoc(r *chi.Mux) {
 		Intro:       "由 chi/docgo 自动生成, 请勿修改",
 	})
 
-	_, err = file.WriteString(content)
+	_, err = file.WriteString(content + accessDoc(router))
 	if err != nil {
 		log.Fatalf("API文档初始化失败: %v", err)
 	}
 }
+
+// accessDoc 生成各路由访问控制的 Markdown 表格。
+func accessDoc(router *rt.Router) string {
+	var doc strings.Builder
+	doc.WriteString("\n## 访问控制\n\n| 方法 | 路径 | 名称 | 公开 | 角色 | 权限 |\n| --- | --- | --- | --- | --- | --- |\n")
+	for _, route := range router.Routes() {
+		public := ""
+		if route.Public {
+			public = "是"
+		}
+		doc.WriteString(fmt.Sprintf("| %s | `%s` | %s | %s | %s | %s |\n",
+			route.Method, route.Path, route.Name, public,
+			strings.Join(route.Roles, " / "), strings.Join(route.Permissions, ", ")))
+	}
+	return doc.String()
+}
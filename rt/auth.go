@@ -0,0 +1,134 @@
+// Package rt 提供了认证与授权的校验以及 Bind 中当前用户字段的填充。
+package rt
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/QingShan-Xu/web/au"
+	"github.com/QingShan-Xu/web/bm"
+	"github.com/mitchellh/mapstructure"
+)
+
+// authTag Bind 中由当前用户填充的字段标签，例如 `auth:"user_id"`。
+const authTag = "auth"
+
+// DefaultAuthorizer 校验 Router.Roles 与 Router.Permissions 的授权器，默认只使用用户自身的角色与权限。
+var DefaultAuthorizer au.Authorizer = au.NewRBAC(nil)
+
+// Bool 返回 v 的指针，用于设置 Router.Public。
+func Bool(v bool) *bool {
+	return &v
+}
+
+// checkAccess 校验认证结果、API Key 允许的路由与配额以及路由声明的角色与权限。
+// Public 路由只消耗 API Key 配额，但声明了角色或权限时与其他路由一样校验；
+// API Key 先校验允许的路由再消耗配额，访问不允许的路由不消耗配额；
+// 未使用认证中间件且没有声明角色与权限的路由同样通过。
+// r: HTTP 请求。
+func (h *handler) checkAccess(r *http.Request) error {
+	principal, ok := au.FromContext(r.Context())
+	restricted := len(h.Router.roles) > 0 || len(h.Router.permissions) > 0
+	if h.Router.public && !restricted {
+		if ok {
+			return principal.TakeQuota()
+		}
+		return nil
+	}
+	if err := au.ErrorFrom(r.Context()); err != nil {
+		return err
+	}
+
+	if ok && principal.APIKey != nil && !principal.APIKey.Allows(h.Router.completeName) {
+		return au.ErrRouteForbidden
+	}
+	if ok {
+		if err := principal.TakeQuota(); err != nil {
+			return err
+		}
+	}
+	if !restricted {
+		return nil
+	}
+	if !ok {
+		return bm.ErrUnauthorized
+	}
+	return DefaultAuthorizer.Authorize(r.Context(), principal, h.Router.roles, h.Router.permissions)
+}
+
+// accessInfo 返回路由信息中的访问控制说明。
+func (r *Router) accessInfo() string {
+	var info strings.Builder
+	if r.public {
+		info.WriteString(" public")
+	}
+	if len(r.roles) > 0 {
+		info.WriteString(" roles=" + strings.Join(r.roles, "|"))
+	}
+	if len(r.permissions) > 0 {
+		info.WriteString(" permissions=" + strings.Join(r.permissions, ","))
+	}
+	if r.rateLimit != nil {
+		info.WriteString(fmt.Sprintf(" rate=%d/%s", r.rateLimit.Requests, r.rateLimit.window()))
+	}
+	return info.String()
+}
+
+// bindAuth 使用当前用户填充 Bind 中带有 auth 标签的字段，这些字段不接受请求中的参数。
+// r: HTTP 请求。
+// bindValue: 绑定数据的实例。
+func (b *binder) bindAuth(r *http.Request, bindValue interface{}) error {
+	if !zeroAuthFields(reflect.ValueOf(bindValue).Elem()) {
+		return nil
+	}
+	principal, ok := au.FromContext(r.Context())
+	if !ok {
+		return nil
+	}
+
+	values := map[string]interface{}{}
+	for key, value := range principal.Claims {
+		values[key] = value
+	}
+	for _, key := range []string{"id", "user_id", "tenant_id", "roles", "permissions"} {
+		if value, ok := principal.Value(key); ok {
+			values[key] = value
+		}
+	}
+
+	decoder, _ := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Squash:               true,
+		WeaklyTypedInput:     true,
+		TagName:              authTag,
+		IgnoreUntaggedFields: true,
+		Result:               bindValue,
+	})
+	if err := decoder.Decode(values); err != nil {
+		return fmt.Errorf("failed to decode principal: %w", err)
+	}
+	return nil
+}
+
+// zeroAuthFields 清空带有 auth 标签的字段，包括嵌入结构体中的字段。
+// 返回是否存在 auth 标签的字段。
+func zeroAuthFields(value reflect.Value) bool {
+	if value.Kind() != reflect.Struct {
+		return false
+	}
+	found := false
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if _, ok := field.Tag.Lookup(authTag); ok {
+			value.Field(i).SetZero()
+			found = true
+		} else if field.Anonymous && zeroAuthFields(value.Field(i)) {
+			found = true
+		}
+	}
+	return found
+}
@@ -9,12 +9,17 @@ import (
 	"net/http"
 	"net/url"
 	"reflect"
+	"sort"
 	"strings"
 
+	"github.com/QingShan-Xu/web/bm"
 	"github.com/go-chi/chi/v5"
 	"github.com/mitchellh/mapstructure"
 )
 
+// headerTag Bind 中从请求头部绑定的字段标签，例如 `header:"X-Token"`，名称不区分大小写。
+const headerTag = "header"
+
 // binder 实现了数据绑定和验证的功能。
 type binder struct{}
 
@@ -43,6 +48,11 @@ func (b *binder) bindAndValidate(routerBind interface{}, r *http.Request) (inter
 		return nil, err
 	}
 
+	// 填充当前用户，覆盖请求中的同名参数。
+	if err := b.bindAuth(r, bindData); err != nil {
+		return nil, err
+	}
+
 	// 执行数据验证。
 	if err := b.validateData(bindData); err != nil {
 		return nil, err
@@ -81,6 +91,18 @@ func (b *binder) bindData(r *http.Request, bindValue interface{}) error {
 		return fmt.Errorf("failed to decode query parameters: %w", err)
 	}
 
+	// 解析请求头部，WebSocket 在升级前同样绑定。
+	headerDecoder, _ := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Squash:               true,
+		WeaklyTypedInput:     true,
+		TagName:              headerTag,
+		IgnoreUntaggedFields: true,
+		Result:               bindValue,
+	})
+	if err := headerDecoder.Decode(valuesToMap(url.Values(r.Header))); err != nil {
+		return fmt.Errorf("failed to decode header parameters: %w", err)
+	}
+
 	// 解析请求体数据（仅针对非 GET 请求）。
 	if r.Method != http.MethodGet {
 		contentType := r.Header.Get("Content-Type")
@@ -122,7 +144,7 @@ func (b *binder) bindData(r *http.Request, bindValue interface{}) error {
 					return fmt.Errorf("failed to decode form data: %w", err)
 				}
 			default:
-				return fmt.Errorf("not allowed Content-Type header: %w", mediaType)
+				return fmt.Errorf("not allowed Content-Type header: %s", mediaType)
 			}
 		}
 	}
@@ -130,6 +152,20 @@ func (b *binder) bindData(r *http.Request, bindValue interface{}) error {
 	return nil
 }
 
+// ValidationError 表示绑定数据的验证错误。
+type ValidationError struct {
+	Params []bm.InvalidParam // 按字段名排序的错误列表
+}
+
+// Error 实现 error 接口。
+func (e *ValidationError) Error() string {
+	errorMessages := make([]string, 0, len(e.Params))
+	for _, param := range e.Params {
+		errorMessages = append(errorMessages, param.Reason)
+	}
+	return strings.Join(errorMessages, ", ")
+}
+
 // validateData 验证绑定的数据。
 // bindValue: 绑定数据的实例。
 func (b *binder) validateData(bindValue interface{}) error {
@@ -137,13 +173,19 @@ func (b *binder) validateData(bindValue interface{}) error {
 	if validationErrors == nil {
 		return nil
 	}
-	var errorMessages []string
+	validationError := &ValidationError{}
 	for field, errMsg := range validationErrors {
 		snakeField := ToSnakeCase(field)
 		formattedMsg := strings.ReplaceAll(errMsg, field, snakeField)
-		errorMessages = append(errorMessages, formattedMsg)
+		validationError.Params = append(validationError.Params, bm.InvalidParam{
+			Name:   strings.TrimPrefix(snakeField[strings.LastIndex(snakeField, ".")+1:], "_"),
+			Reason: formattedMsg,
+		})
 	}
-	return fmt.Errorf("%v", strings.Join(errorMessages, ", "))
+	sort.Slice(validationError.Params, func(i, j int) bool {
+		return validationError.Params[i].Name < validationError.Params[j].Name
+	})
+	return validationError
 }
 
 // valuesToMap 将 url.Values 转换为 map[string]interface{}。
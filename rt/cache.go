@@ -0,0 +1,297 @@
+// Package rt 提供了路由级别的响应缓存。
+package rt
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/QingShan-Xu/web/au"
+)
+
+const (
+	CacheHeader      = "X-Cache" // 标记缓存命中情况的响应头
+	MaxCacheBodySize = 1 << 20   // 可缓存的最大响应体字节数
+	DefaultCacheSize = 1000      // 默认内存缓存的最大条目数
+)
+
+// Cache 定义了路由的响应缓存，仅缓存 GET 请求的成功响应。
+type Cache struct {
+	TTL     time.Duration                // 过期时间
+	Headers []string                     // 参与缓存键的请求头，Accept 总是参与
+	KeyFunc func(r *http.Request) string // 额外的缓存键，例如当前用户 ID
+	Depends []interface{}                // 额外依赖的模型，这些模型的写操作同样使缓存失效
+	Store   CacheStore                   // 缓存存储，为空时使用 DefaultCacheStore
+}
+
+// CacheEntry 缓存的响应。
+type CacheEntry struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// CacheStore 缓存存储接口。
+type CacheStore interface {
+	// Get 读取未过期的缓存。
+	Get(key string) (*CacheEntry, bool)
+	// Set 写入缓存并关联标签。
+	Set(key string, entry *CacheEntry, ttl time.Duration, tags []string)
+	// Invalidate 删除关联了 tag 的全部缓存。
+	Invalidate(tag string)
+}
+
+// DefaultCacheStore 默认的缓存存储，可通过 App.CacheSize 配置容量。
+var DefaultCacheStore CacheStore = NewMemoryCache(DefaultCacheSize)
+
+// cacheStores 写入过缓存的存储，写操作成功后在这些存储中失效缓存。
+var cacheStores sync.Map
+
+// store 返回路由使用的缓存存储。
+func (c *Cache) store() CacheStore {
+	if c.Store != nil {
+		return c.Store
+	}
+	return DefaultCacheStore
+}
+
+// cacheKey 根据路径、查询参数、绑定数据、指定请求头与当前用户生成缓存键。
+func (h *handler) cacheKey(r *http.Request, bindData interface{}) (string, error) {
+	bind, err := json.Marshal(bindData)
+	if err != nil {
+		return "", err
+	}
+
+	var b bytes.Buffer
+	b.WriteString(r.URL.Path)
+	b.WriteByte('?')
+	b.WriteString(r.URL.Query().Encode())
+	b.WriteByte('\n')
+	b.Write(bind)
+	for _, name := range append([]string{"Accept"}, h.Router.Cache.Headers...) {
+		b.WriteByte('\n')
+		b.WriteString(r.Header.Get(name))
+	}
+	// 认证后的响应可能依赖当前用户，不同用户不共享缓存。
+	if principal, ok := au.FromContext(r.Context()); ok {
+		fmt.Fprintf(&b, "\nprincipal=%s/%s", principal.TenantID, principal.ID)
+	}
+	for _, scope := range h.dataScope {
+		fmt.Fprintf(&b, "\n%s=%v", scope.column, scope.value)
+	}
+	if h.Router.Cache.KeyFunc != nil {
+		b.WriteByte('\n')
+		b.WriteString(h.Router.Cache.KeyFunc(r))
+	}
+
+	sum := sha256.Sum256(b.Bytes())
+	return h.Router.completeName + ":" + hex.EncodeToString(sum[:]), nil
+}
+
+// cacheTags 返回路由缓存关联的模型标签。
+func (h *handler) cacheTags() []string {
+	tags := []string{}
+	if h.Router.Model != nil {
+		tags = append(tags, modelTag(h.Router.Model))
+	}
+	for _, model := range h.Router.Cache.Depends {
+		tags = append(tags, modelTag(model))
+	}
+	return tags
+}
+
+// invalidateCache 写操作成功后使关联了当前模型的缓存失效。
+func (h *handler) invalidateCache() {
+	if h.Router.Model == nil {
+		return
+	}
+	tag := modelTag(h.Router.Model)
+	cacheStores.Range(func(store, _ interface{}) bool {
+		store.(CacheStore).Invalidate(tag)
+		return true
+	})
+}
+
+// isWriteFinisher 判断路由是否为修改数据的 Finisher。
+func (h *handler) isWriteFinisher() bool {
+	return h.Router.CreateOne != nil || h.Router.UpdateOne != nil || h.Router.DeleteOne || h.Router.Import != nil
+}
+
+// modelTag 返回模型的缓存标签。
+func modelTag(model interface{}) string {
+	t := reflect.TypeOf(model)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.PkgPath() + "." + t.Name()
+}
+
+// cacheRecorder 记录写出的响应以便写入缓存。
+type cacheRecorder struct {
+	http.ResponseWriter
+	key      string // 缓存键，为空时不写入缓存
+	status   int
+	header   http.Header
+	body     bytes.Buffer
+	overflow bool
+}
+
+// WriteHeader 记录状态码与响应头。
+func (c *cacheRecorder) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+		c.header = c.ResponseWriter.Header().Clone()
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+// Write 写出并记录响应体，超过 MaxCacheBodySize 时放弃记录。
+func (c *cacheRecorder) Write(p []byte) (int, error) {
+	if c.status == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+	if !c.overflow {
+		if c.body.Len()+len(p) > MaxCacheBodySize {
+			c.overflow = true
+			c.body = bytes.Buffer{}
+		} else {
+			c.body.Write(p)
+		}
+	}
+	return c.ResponseWriter.Write(p)
+}
+
+// Flush 实现 http.Flusher 接口，流式响应不写入缓存。
+func (c *cacheRecorder) Flush() {
+	c.overflow = true
+	c.body = bytes.Buffer{}
+	http.NewResponseController(c.ResponseWriter).Flush()
+}
+
+// Unwrap 返回原始的 http.ResponseWriter，供 http.ResponseController 使用。
+func (c *cacheRecorder) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// save 将成功的响应写入缓存，未使用真实状态码时以响应的业务码判断是否成功。
+// h: 处理器。
+// code: 响应的业务码。
+func (c *cacheRecorder) save(h *handler, code int) {
+	if c.key == "" || c.overflow || c.status != http.StatusOK || code >= http.StatusBadRequest {
+		return
+	}
+	store := h.Router.Cache.store()
+	cacheStores.Store(store, struct{}{})
+	store.Set(c.key, &CacheEntry{
+		Status: c.status,
+		Header: c.header,
+		Body:   bytes.Clone(c.body.Bytes()),
+	}, h.Router.Cache.TTL, h.cacheTags())
+}
+
+// MemoryCache 基于 LRU 的内存缓存存储。
+type MemoryCache struct {
+	mu       sync.Mutex
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List
+	tags     map[string]map[string]struct{}
+}
+
+// memoryItem 内存缓存中的条目。
+type memoryItem struct {
+	key     string
+	entry   *CacheEntry
+	expires time.Time
+	tags    []string
+}
+
+// NewMemoryCache 创建内存缓存存储。
+// capacity: 最大条目数，超出时淘汰最久未使用的条目，小于等于 0 时使用 DefaultCacheSize。
+func NewMemoryCache(capacity int) *MemoryCache {
+	if capacity <= 0 {
+		capacity = DefaultCacheSize
+	}
+	return &MemoryCache{
+		capacity: capacity,
+		items:    map[string]*list.Element{},
+		order:    list.New(),
+		tags:     map[string]map[string]struct{}{},
+	}
+}
+
+// Get 实现 CacheStore 接口。
+func (m *MemoryCache) Get(key string) (*CacheEntry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	element, ok := m.items[key]
+	if !ok {
+		return nil, false
+	}
+	item := element.Value.(*memoryItem)
+	if !item.expires.IsZero() && time.Now().After(item.expires) {
+		m.remove(element)
+		return nil, false
+	}
+	m.order.MoveToFront(element)
+	return item.entry, true
+}
+
+// Set 实现 CacheStore 接口，ttl 小于等于 0 时不过期。
+func (m *MemoryCache) Set(key string, entry *CacheEntry, ttl time.Duration, tags []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if element, ok := m.items[key]; ok {
+		m.remove(element)
+	}
+
+	item := &memoryItem{key: key, entry: entry, tags: tags}
+	if ttl > 0 {
+		item.expires = time.Now().Add(ttl)
+	}
+	m.items[key] = m.order.PushFront(item)
+	for _, tag := range tags {
+		if m.tags[tag] == nil {
+			m.tags[tag] = map[string]struct{}{}
+		}
+		m.tags[tag][key] = struct{}{}
+	}
+
+	for m.order.Len() > m.capacity {
+		m.remove(m.order.Back())
+	}
+}
+
+// Invalidate 实现 CacheStore 接口。
+func (m *MemoryCache) Invalidate(tag string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key := range m.tags[tag] {
+		if element, ok := m.items[key]; ok {
+			m.remove(element)
+		}
+	}
+	delete(m.tags, tag)
+}
+
+// remove 删除条目及其标签索引，调用方需持有锁。
+func (m *MemoryCache) remove(element *list.Element) {
+	item := m.order.Remove(element).(*memoryItem)
+	delete(m.items, item.key)
+	for _, tag := range item.tags {
+		delete(m.tags[tag], item.key)
+		if len(m.tags[tag]) == 0 {
+			delete(m.tags, tag)
+		}
+	}
+}
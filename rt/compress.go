@@ -0,0 +1,367 @@
+// Package rt 提供了响应压缩中间件。
+package rt
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	EncodingZstd           = "zstd"
+	EncodingGzip           = "gzip"
+	EncodingDeflate        = "deflate"
+	DefaultCompressMinSize = 1024 // 默认的最小压缩字节数
+)
+
+// DefaultCompressTypes 默认允许压缩的 Content-Type，支持 "text/*" 形式的通配。
+var DefaultCompressTypes = []string{
+	"text/*",
+	"application/json",
+	"application/problem+json",
+	"application/x-ndjson",
+	"application/xml",
+	"application/problem+xml",
+	"application/yaml",
+	"application/javascript",
+	"image/svg+xml",
+}
+
+// compressEncodings 支持的编码，按优先级排序。
+var compressEncodings = []string{EncodingZstd, EncodingGzip, EncodingDeflate}
+
+// compressEncoder 压缩编码器。
+type compressEncoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// zstdEncoder 适配 zstd.Encoder 的 Reset 签名。
+type zstdEncoder struct {
+	*zstd.Encoder
+}
+
+func (e zstdEncoder) Reset(w io.Writer) {
+	e.Encoder.Reset(w)
+}
+
+// compressor 压缩中间件的配置与编码器池。
+type compressor struct {
+	minSize int
+	types   []string
+	pools   map[string]*sync.Pool
+}
+
+// Compress 返回响应压缩中间件，按 Accept-Encoding 选择 zstd、gzip 或 deflate。
+// 小于 minSize 的响应、已设置 Content-Encoding 的响应、Range 响应以及 WebSocket 升级请求不压缩；
+// 流式响应在 Flush 时同步刷新压缩数据。
+// level: 压缩级别，0 或超出 gzip 级别范围时使用默认级别，zstd 按 gzip 级别映射。
+// minSize: 最小压缩字节数，小于等于 0 时使用 DefaultCompressMinSize。
+// types: 允许压缩的 Content-Type，为空时使用 DefaultCompressTypes。
+func Compress(level, minSize int, types ...string) func(next http.Handler) http.Handler {
+	if level == 0 || validCompressLevel(level) != nil {
+		level = gzip.DefaultCompression
+	}
+	if minSize <= 0 {
+		minSize = DefaultCompressMinSize
+	}
+	if len(types) == 0 {
+		types = DefaultCompressTypes
+	}
+
+	c := &compressor{
+		minSize: minSize,
+		types:   types,
+		pools: map[string]*sync.Pool{
+			EncodingGzip: {New: func() interface{} {
+				w, _ := gzip.NewWriterLevel(io.Discard, level)
+				return w
+			}},
+			EncodingDeflate: {New: func() interface{} {
+				w, _ := flate.NewWriter(io.Discard, level)
+				return w
+			}},
+			EncodingZstd: {New: func() interface{} {
+				w, _ := zstd.NewWriter(io.Discard, zstd.WithEncoderLevel(zstdLevel(level)), zstd.WithEncoderConcurrency(1))
+				return zstdEncoder{w}
+			}},
+		},
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := c.negotiate(r)
+			if encoding == "" || r.Method == http.MethodHead || isUpgrade(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, c: c, encoding: encoding}
+			defer cw.close()
+			w.Header().Add("Vary", "Accept-Encoding")
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// validCompressLevel 检查压缩级别是否在 gzip 与 deflate 支持的范围内。
+// level: 压缩级别。
+// 返回超出范围时的错误信息。
+func validCompressLevel(level int) error {
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		return fmt.Errorf("compress level %d out of range [%d, %d]", level, gzip.HuffmanOnly, gzip.BestCompression)
+	}
+	return nil
+}
+
+// zstdLevel 将 gzip 压缩级别映射为 zstd 压缩级别。
+func zstdLevel(level int) zstd.EncoderLevel {
+	switch {
+	case level == gzip.DefaultCompression:
+		return zstd.SpeedDefault
+	case level <= gzip.BestSpeed:
+		return zstd.SpeedFastest
+	case level >= gzip.BestCompression:
+		return zstd.SpeedBestCompression
+	case level >= 7:
+		return zstd.SpeedBetterCompression
+	}
+	return zstd.SpeedDefault
+}
+
+// isUpgrade 判断是否为协议升级请求，例如 WebSocket。
+func isUpgrade(r *http.Request) bool {
+	for _, value := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// negotiate 根据 Accept-Encoding 选择编码，q 值相同时按 compressEncodings 的顺序优先。
+func (c *compressor) negotiate(r *http.Request) string {
+	header := r.Header.Get("Accept-Encoding")
+	if header == "" {
+		return ""
+	}
+
+	weights := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		weights[strings.ToLower(strings.TrimSpace(name))] = q
+	}
+
+	candidates := make([]string, 0, len(compressEncodings))
+	for _, encoding := range compressEncodings {
+		q, ok := weights[encoding]
+		if !ok {
+			q, ok = weights["*"]
+		}
+		if ok && q > 0 {
+			candidates = append(candidates, encoding)
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		qi, ok := weights[candidates[i]]
+		if !ok {
+			qi = weights["*"]
+		}
+		qj, ok := weights[candidates[j]]
+		if !ok {
+			qj = weights["*"]
+		}
+		return qi > qj
+	})
+	return candidates[0]
+}
+
+// allowed 判断 Content-Type 是否允许压缩。
+func (c *compressor) allowed(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range c.types {
+		if t == mediaType {
+			return true
+		}
+		// 事件流仅在显式列出时压缩，避免部分代理缓冲压缩后的事件。
+		if strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(t, "*")) && mediaType != "text/event-stream" {
+			return true
+		}
+	}
+	return false
+}
+
+// compressWriter 先缓冲响应，达到最小压缩字节数或 Flush 时再决定是否压缩。
+type compressWriter struct {
+	http.ResponseWriter
+	c        *compressor
+	encoding string
+	status   int
+	buf      []byte
+	decided  bool
+	compress bool
+	hijacked bool
+	encoder  compressEncoder
+}
+
+// WriteHeader 记录状态码，在决定是否压缩后写出。
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.decided || cw.status != 0 {
+		return
+	}
+	if status < http.StatusOK {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	cw.status = status
+}
+
+// Write 写出响应体。
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if cw.decided {
+		return cw.write(p)
+	}
+
+	if cw.ResponseWriter.Header().Get("Content-Type") == "" {
+		cw.ResponseWriter.Header().Set("Content-Type", http.DetectContentType(append(cw.buf, p...)))
+	}
+	if !cw.eligible() {
+		if err := cw.decide(false); err != nil {
+			return 0, err
+		}
+		return cw.write(p)
+	}
+
+	cw.buf = append(cw.buf, p...)
+	if len(cw.buf) >= cw.c.minSize {
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (cw *compressWriter) write(p []byte) (int, error) {
+	if cw.compress {
+		return cw.encoder.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// eligible 根据状态码与响应头判断是否可以压缩。
+func (cw *compressWriter) eligible() bool {
+	header := cw.ResponseWriter.Header()
+	switch {
+	case cw.status == http.StatusNoContent, cw.status == http.StatusNotModified, cw.status == http.StatusPartialContent:
+		return false
+	case header.Get("Content-Encoding") != "", header.Get("Content-Range") != "":
+		return false
+	}
+	return cw.c.allowed(header.Get("Content-Type"))
+}
+
+// decide 写出响应头与已缓冲的数据。
+func (cw *compressWriter) decide(compress bool) error {
+	cw.decided = true
+	cw.compress = compress
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	if compress {
+		header := cw.ResponseWriter.Header()
+		header.Set("Content-Encoding", cw.encoding)
+		header.Del("Content-Length")
+		// 压缩后的表示与原始表示不同，强 ETag 降级为弱 ETag。
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		cw.encoder = cw.c.pools[cw.encoding].Get().(compressEncoder)
+		cw.encoder.Reset(cw.ResponseWriter)
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if len(cw.buf) == 0 {
+		return nil
+	}
+	buf := cw.buf
+	cw.buf = nil
+	_, err := cw.write(buf)
+	return err
+}
+
+// Flush 实现 http.Flusher 接口，流式响应在首次 Flush 时即决定是否压缩。
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if cw.status == 0 && len(cw.buf) == 0 {
+			cw.status = http.StatusOK
+		}
+		cw.decide(cw.eligible())
+	}
+	if cw.compress {
+		cw.encoder.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Hijack 实现 http.Hijacker 接口。
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(cw.ResponseWriter).Hijack()
+	if err == nil {
+		cw.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap 返回原始的 http.ResponseWriter，供 http.ResponseController 使用。
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// close 结束响应，小于最小压缩字节数的响应不压缩。
+func (cw *compressWriter) close() {
+	if cw.hijacked {
+		return
+	}
+	if !cw.decided {
+		if cw.status == 0 {
+			return
+		}
+		cw.decide(len(cw.buf) >= cw.c.minSize && cw.eligible())
+	}
+	if cw.compress {
+		cw.encoder.Close()
+		cw.encoder.Reset(io.Discard)
+		cw.c.pools[cw.encoding].Put(cw.encoder)
+		cw.encoder = nil
+	}
+}
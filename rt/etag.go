@@ -0,0 +1,64 @@
+// Package rt 提供了 ETag 与条件请求的处理。
+package rt
+
+import (
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/QingShan-Xu/web/bm"
+)
+
+// UpdatedAtField 用于生成 Last-Modified 的模型字段名。
+const UpdatedAtField = "UpdatedAt"
+
+// withValidators 为读取操作的响应设置 ETag 与 Last-Modified。
+// data: 响应数据，用于计算 ETag。
+// models: 查询到的模型，用于读取 UpdatedAt；列表传入 nil，只设置 ETag。
+func (h *handler) withValidators(response *bm.Res, data, models interface{}) error {
+	if !h.Router.ETag {
+		return nil
+	}
+	etag, err := bm.ETag(data)
+	if err != nil {
+		return err
+	}
+	response.WithETag(etag).WithLastModified(lastModified(models))
+	return nil
+}
+
+// checkIfMatch 校验写操作的 If-Match 头部，ETag 与 Preload 相同、不带 fields 参数的 GetOne 一致。
+// r: HTTP 请求。
+// model: 当前数据库中的模型。
+func (h *handler) checkIfMatch(r *http.Request, model interface{}) error {
+	if !h.Router.ETag {
+		return nil
+	}
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return bm.ErrPreconditionRequired
+	}
+	etag, err := bm.ETag(model)
+	if err != nil {
+		return err
+	}
+	if !bm.ETagMatchResource(header, etag) {
+		return bm.ErrPreconditionFailed
+	}
+	return nil
+}
+
+// lastModified 读取模型的 UpdatedAt 字段，没有该字段时返回零值。
+// 列表的最大 UpdatedAt 不随删除或翻页变化，因此列表不使用 Last-Modified。
+func lastModified(model interface{}) time.Time {
+	value := reflect.Indirect(reflect.ValueOf(model))
+	if !value.IsValid() || value.Kind() != reflect.Struct {
+		return time.Time{}
+	}
+	field := value.FieldByName(UpdatedAtField)
+	if !field.IsValid() {
+		return time.Time{}
+	}
+	t, _ := field.Interface().(time.Time)
+	return t
+}
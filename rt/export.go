@@ -0,0 +1,252 @@
+// Package rt 提供了 GetList 的 CSV/Excel 导出功能。
+package rt
+
+import (
+	"database/sql/driver"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/QingShan-Xu/web/bm"
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	ExportQuery     = "format" // 导出格式查询参数名
+	ExportCSV       = "csv"    // CSV 导出格式
+	ExportXLSX      = "xlsx"   // Excel 导出格式
+	ExportBatchSize = 500      // 导出时每批查询的行数
+	ExportTimeFmt   = "2006-01-02 15:04:05"
+	exportSheetName = "Sheet1"
+)
+
+// exportColumn 导出列的定义。
+type exportColumn struct {
+	index  []int  // 字段在模型中的索引路径
+	name   string // 字段名称
+	json   string // 字段 json 名称
+	header string // 列标题
+}
+
+// exportFormat 根据 format 参数或 Accept 头部判断导出格式。
+// r: HTTP 请求。
+// 返回导出格式，不导出时返回空字符串。
+func exportFormat(r *http.Request) string {
+	switch strings.ToLower(r.URL.Query().Get(ExportQuery)) {
+	case ExportCSV:
+		return ExportCSV
+	case ExportXLSX:
+		return ExportXLSX
+	}
+
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, "text/csv"):
+		return ExportCSV
+	case strings.Contains(accept, bm.ContentTypeXLSX):
+		return ExportXLSX
+	}
+	return ""
+}
+
+// parseExportColumns 解析模型的导出列，列标题取 label 标签，其次 json 标签，最后字段名。
+// modelType: 模型类型。
+// 返回导出列列表。
+func parseExportColumns(modelType reflect.Type) []exportColumn {
+	var columns []exportColumn
+	for i := 0; i < modelType.NumField(); i++ {
+		field := modelType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		// 展开嵌入字段，例如 bm.Model。
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			for _, column := range parseExportColumns(field.Type) {
+				column.index = append([]int{i}, column.index...)
+				columns = append(columns, column)
+			}
+			continue
+		}
+
+		name := jsonName(field)
+		if name == "-" || !exportable(field.Type) {
+			continue
+		}
+
+		header := field.Tag.Get("label")
+		if header == "" {
+			header = name
+		}
+		columns = append(columns, exportColumn{
+			index:  []int{i},
+			name:   field.Name,
+			json:   name,
+			header: header,
+		})
+	}
+	return columns
+}
+
+// exportable 检查字段类型能否作为单元格导出，关联和集合类型将被跳过。
+func exportable(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == reflect.TypeOf(time.Time{}) || t.Implements(reflect.TypeOf((*driver.Valuer)(nil)).Elem()) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.Slice, reflect.Array, reflect.Map, reflect.Interface, reflect.Func, reflect.Chan:
+		return false
+	}
+	return true
+}
+
+// cellValue 将字段值格式化为单元格内容。
+func (c exportColumn) cellValue(row reflect.Value) string {
+	value := row.FieldByIndex(c.index)
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return ""
+		}
+		value = value.Elem()
+	}
+
+	switch v := value.Interface().(type) {
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.Format(ExportTimeFmt)
+	case driver.Valuer:
+		dv, err := v.Value()
+		if err != nil || dv == nil {
+			return ""
+		}
+		if t, ok := dv.(time.Time); ok {
+			return t.Format(ExportTimeFmt)
+		}
+		return fmt.Sprint(dv)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// export 以文件形式导出与当前查询条件匹配的全部数据。
+// currentDB: 已应用查询范围的数据库会话。
+// format: 导出格式。
+// selection: 客户端选择的字段，可为 nil。
+// response: 响应实例。
+func (h *handler) export(currentDB *gorm.DB, format string, selection *fieldSelection, response *bm.Res) *bm.Res {
+	modelType := reflect.Indirect(reflect.ValueOf(h.Router.Model)).Type()
+	columns := parseExportColumns(modelType)
+	if selection != nil {
+		selected := columns[:0]
+		for _, column := range columns {
+			if _, ok := selection.tree[column.json]; ok {
+				selected = append(selected, column)
+			}
+		}
+		columns = selected
+	}
+
+	fileName := h.Router.Name
+	if fileName == "" {
+		fileName = "export"
+	}
+	fileName += "." + format
+
+	rows := func(write func(record []string) error) error {
+		return h.eachRow(currentDB, ExportBatchSize, func(row reflect.Value) error {
+			record := make([]string, len(columns))
+			for j, column := range columns {
+				record[j] = column.cellValue(row)
+			}
+			return write(record)
+		})
+	}
+
+	headers := make([]string, len(columns))
+	for i, column := range columns {
+		headers[i] = column.header
+	}
+
+	if format == ExportXLSX {
+		return response.SucFileWriter(fileName, bm.ContentTypeXLSX, func(w io.Writer) error {
+			return writeXLSX(w, headers, rows)
+		})
+	}
+	return response.SucFileWriter(fileName, bm.ContentTypeCSV, func(w io.Writer) error {
+		return writeCSV(w, headers, rows)
+	})
+}
+
+// writeCSV 写出 CSV 文件，带 UTF-8 BOM 以便 Excel 正确识别中文。
+func writeCSV(w io.Writer, headers []string, rows func(write func(record []string) error) error) error {
+	if _, err := io.WriteString(w, "\xEF\xBB\xBF"); err != nil {
+		return err
+	}
+	csvWriter := csv.NewWriter(w)
+	if err := csvWriter.Write(headers); err != nil {
+		return err
+	}
+
+	count := 0
+	err := rows(func(record []string) error {
+		count++
+		if count%ExportBatchSize == 0 {
+			csvWriter.Flush()
+		}
+		return csvWriter.Write(record)
+	})
+	if err != nil {
+		return err
+	}
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// writeXLSX 使用流式写入器写出 Excel 文件。
+func writeXLSX(w io.Writer, headers []string, rows func(write func(record []string) error) error) error {
+	file := excelize.NewFile()
+	defer file.Close()
+
+	streamWriter, err := file.NewStreamWriter(exportSheetName)
+	if err != nil {
+		return err
+	}
+
+	rowNum := 1
+	writeRow := func(record []string) error {
+		cells := make([]interface{}, len(record))
+		for i, value := range record {
+			cells[i] = value
+		}
+		cell, err := excelize.CoordinatesToCellName(1, rowNum)
+		if err != nil {
+			return err
+		}
+		rowNum++
+		return streamWriter.SetRow(cell, cells)
+	}
+
+	if err := writeRow(headers); err != nil {
+		return err
+	}
+	if err := rows(writeRow); err != nil {
+		return err
+	}
+	if err := streamWriter.Flush(); err != nil {
+		return err
+	}
+
+	_, err = file.WriteTo(w)
+	return err
+}
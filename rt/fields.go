@@ -0,0 +1,241 @@
+// Package rt 提供了稀疏字段集（fields 查询参数）的解析与裁剪功能。
+package rt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/QingShan-Xu/web/ds"
+)
+
+// FieldsQuery 客户端选择返回字段的查询参数名，例如 ?fields=id,name,owner.name。
+const FieldsQuery = "fields"
+
+// fieldTree 以 json 名称组织的字段树，空树表示保留整个值。
+type fieldTree map[string]fieldTree
+
+// fieldSelection 客户端选择的字段。
+type fieldSelection struct {
+	columns []string  // SELECT 的数据库列
+	tree    fieldTree // 序列化时保留的字段
+}
+
+// parseFields 解析请求中的 fields 参数。
+// r: HTTP 请求。
+// 未携带 fields 参数时返回 nil。
+func (h *handler) parseFields(r *http.Request) (*fieldSelection, error) {
+	raw := strings.TrimSpace(r.URL.Query().Get(FieldsQuery))
+	if raw == "" {
+		return nil, nil
+	}
+
+	modelType := reflect.Indirect(reflect.ValueOf(h.Router.Model)).Type()
+	modelReader, err := ds.NewStructReader(reflect.New(modelType).Interface())
+	if err != nil {
+		return nil, err
+	}
+	modelSchema, err := parseModelSchema(h.Router.Model)
+	if err != nil {
+		return nil, err
+	}
+
+	selection := &fieldSelection{tree: fieldTree{}}
+	columnSet := map[string]bool{}
+	addColumn := func(column string) {
+		if column != "" && !columnSet[column] {
+			columnSet[column] = true
+			selection.columns = append(selection.columns, column)
+		}
+	}
+	// 主键始终查询，保证关联预加载可用。
+	for _, field := range modelSchema.PrimaryFields {
+		addColumn(field.DBName)
+	}
+
+	for _, path := range strings.Split(raw, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		if !h.fieldAllowed(path) {
+			return nil, fmt.Errorf("field '%s' is not selectable", path)
+		}
+
+		goPath, err := resolveFieldPath(modelType, path)
+		if err != nil {
+			return nil, err
+		}
+		// 顶层字段必须存在于 Model 中。
+		if _, err := modelReader.GetField(goPath[0]); err != nil {
+			return nil, fmt.Errorf("field '%s' is not selectable", path)
+		}
+
+		if field, ok := modelSchema.FieldsByName[goPath[0]]; ok && field.DBName != "" {
+			addColumn(field.DBName)
+		}
+		if rel, ok := modelSchema.Relationships.Relations[goPath[0]]; ok {
+			for _, ref := range rel.References {
+				if ref.OwnPrimaryKey && ref.PrimaryKey != nil {
+					addColumn(ref.PrimaryKey.DBName)
+				} else if !ref.OwnPrimaryKey && ref.ForeignKey != nil {
+					addColumn(ref.ForeignKey.DBName)
+				}
+			}
+		}
+
+		selection.tree.add(strings.Split(path, "."))
+	}
+
+	if len(selection.tree) == 0 {
+		return nil, nil
+	}
+
+	return selection, nil
+}
+
+// fieldAllowed 检查字段是否在 Router.Fields 白名单中。
+// 白名单为空时允许 Model 的全部字段；白名单中的字段允许选择其子字段。
+func (h *handler) fieldAllowed(path string) bool {
+	if len(h.Router.Fields) == 0 {
+		return true
+	}
+	for _, allowed := range h.Router.Fields {
+		if path == allowed || strings.HasPrefix(path, allowed+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveFieldPath 将 json 名称路径解析为 ds.FieldReader 可识别的字段名路径。
+// modelType: 模型类型。
+// path: json 名称路径，例如 "owner.name"。
+// 返回字段名组成的切片，例如 ["Owner", "Name"]。
+func resolveFieldPath(modelType reflect.Type, path string) ([]string, error) {
+	var goPath []string
+	currentType := modelType
+	for _, component := range strings.Split(path, ".") {
+		currentType = indirectElemType(currentType)
+		if currentType.Kind() != reflect.Struct || currentType == reflect.TypeOf(time.Time{}) {
+			return nil, fmt.Errorf("field '%s' is not selectable", path)
+		}
+		field, ok := lookupJSONField(currentType, component)
+		if !ok {
+			return nil, fmt.Errorf("field '%s' is not selectable", path)
+		}
+		goPath = append(goPath, field.Name)
+		currentType = field.Type
+	}
+	return goPath, nil
+}
+
+// lookupJSONField 根据 json 名称查找结构体字段，支持嵌入字段。
+func lookupJSONField(structType reflect.Type, name string) (reflect.StructField, bool) {
+	if name == "-" {
+		return reflect.StructField{}, false
+	}
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if field.Anonymous && indirectElemType(field.Type).Kind() == reflect.Struct {
+			if _, tagged := field.Tag.Lookup("json"); !tagged {
+				if embedded, ok := lookupJSONField(indirectElemType(field.Type), name); ok {
+					return embedded, true
+				}
+				continue
+			}
+		}
+		if jsonName(field) == name {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// jsonName 返回字段序列化后的 json 名称，忽略的字段返回 "-"。
+func jsonName(field reflect.StructField) string {
+	tag := strings.Split(field.Tag.Get("json"), ",")[0]
+	if tag == "" {
+		return field.Name
+	}
+	return tag
+}
+
+// indirectElemType 解开指针、切片与数组，返回元素类型。
+func indirectElemType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	return t
+}
+
+// add 将路径加入字段树。
+func (t fieldTree) add(components []string) {
+	subtree, ok := t[components[0]]
+	if len(components) == 1 {
+		// 选择了整个字段，覆盖已有的子字段选择。
+		t[components[0]] = nil
+		return
+	}
+	if ok && subtree == nil {
+		return
+	}
+	if subtree == nil {
+		subtree = fieldTree{}
+		t[components[0]] = subtree
+	}
+	subtree.add(components[1:])
+}
+
+// prune 按字段树裁剪数据。
+// data: 模型实例或模型切片。
+// 返回只包含所选字段的数据。
+func (t fieldTree) prune(data interface{}) (interface{}, error) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err := unmarshalNumber(body, &value); err != nil {
+		return nil, err
+	}
+	return t.pruneValue(value), nil
+}
+
+// unmarshalNumber 解码 json，数字保留为 json.Number，避免超过 2^53 的整数丢失精度。
+func unmarshalNumber(body []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// pruneValue 递归裁剪 json 值。
+func (t fieldTree) pruneValue(value interface{}) interface{} {
+	if t == nil {
+		return value
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(t))
+		for key, subtree := range t {
+			if item, ok := v[key]; ok {
+				result[key] = subtree.pruneValue(item)
+			}
+		}
+		return result
+	case []interface{}:
+		for i := range v {
+			v[i] = t.pruneValue(v[i])
+		}
+		return v
+	default:
+		return value
+	}
+}
@@ -2,10 +2,13 @@
 package rt
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"reflect"
 
+	"github.com/QingShan-Xu/web/au"
 	"github.com/QingShan-Xu/web/bm"
 	"github.com/QingShan-Xu/web/db"
 	"github.com/QingShan-Xu/web/ds"
@@ -15,7 +18,10 @@ import (
 
 // handler 处理请求的核心逻辑。
 type handler struct {
-	Router *Router
+	Router    *Router
+	recorder  *cacheRecorder   // 启用缓存时记录响应
+	ctx       context.Context  // 数据库查询使用的上下文
+	dataScope []dataScopeValue // 当前用户的行级数据范围
 }
 
 // serveHTTP 实现 http.Handler 接口。
@@ -24,17 +30,27 @@ type handler struct {
 func (h *handler) serveHTTP(w http.ResponseWriter, r *http.Request) *bm.Res {
 	var bindData interface{}
 	var err error
-	response := bm.NewRes(w)
+	response := bm.NewRes(w).WithRequest(r)
 
-	if h.Router.Bind != nil {
+	// 导入操作的 Bind 描述单行数据，不绑定请求。
+	if h.Router.Bind != nil && h.Router.Import == nil {
 		// 数据绑定和验证。
 		binder := newBinder()
 		bindData, err = binder.bindAndValidate(h.Router.Bind, r)
 		if err != nil {
+			var validationError *ValidationError
+			if errors.As(err, &validationError) {
+				response.Extend(bm.ProblemInvalidParams, validationError.Params)
+			}
+			if limitErr, ok := limitError(err); ok {
+				return response.Fail(limitErr)
+			}
 			return response.FailFront(err)
 		}
 	}
 
+	principal, _ := au.FromContext(r.Context())
+
 	var bindReader ds.FieldReader
 	if bindData != nil {
 		// 使用 ds 包解析绑定数据。
@@ -44,14 +60,37 @@ func (h *handler) serveHTTP(w http.ResponseWriter, r *http.Request) *bm.Res {
 		}
 	}
 
+	// 解析行级数据范围，缓存键同样依赖于此。
+	if err := h.resolveDataScope(r); err != nil {
+		return response.Fail(err)
+	}
+
+	// 命中缓存时直接返回缓存的响应。
+	if h.recorder != nil {
+		key, err := h.cacheKey(r, bindData)
+		if err != nil {
+			return response.FailBackend(err)
+		}
+		if entry, ok := h.Router.Cache.store().Get(key); ok {
+			header := entry.Header.Clone()
+			header.Set(CacheHeader, "HIT")
+			return response.SucRaw(entry.Status, header, entry.Body)
+		}
+		h.recorder.key = key
+		w.Header().Set(CacheHeader, "MISS")
+	}
+
 	fmt.Printf("%+v", bindData)
-	currentDB := db.DB.GORM.Session(&gorm.Session{})
+	currentDB := db.DB.GORM.WithContext(h.ctx)
 
 	// 应用查询范围（Scopes）。
 	var scopes []func(db *gorm.DB) *gorm.DB
 	for _, scope := range h.Router.Scopes {
 		scopes = append(scopes, scope(bindReader))
 	}
+	if len(h.dataScope) > 0 {
+		scopes = append(scopes, h.dataScopeQuery)
+	}
 	currentDB = currentDB.Scopes(scopes...)
 
 	// 检查是否同时设置了多个 Finisher 方法。
@@ -71,6 +110,12 @@ func (h *handler) serveHTTP(w http.ResponseWriter, r *http.Request) *bm.Res {
 	if h.Router.GetList {
 		finisherMethodCount++
 	}
+	if h.Router.Import != nil {
+		finisherMethodCount++
+	}
+	if h.Router.GetTree != nil {
+		finisherMethodCount++
+	}
 
 	if finisherMethodCount > 1 {
 		fmt.Println("Cannot use multiple finisher methods simultaneously")
@@ -78,64 +123,244 @@ func (h *handler) serveHTTP(w http.ResponseWriter, r *http.Request) *bm.Res {
 
 	}
 
+	if h.Router.WebSocket != nil {
+		if finisherMethodCount > 0 || h.Router.Handler != nil || h.Router.Stream != nil {
+			return response.FailBackend("Router.WebSocket cannot be used with Handler, Stream or finisher methods")
+		}
+		return h.serveWebSocket(w, r, bindReader, currentDB, response)
+	}
+
+	if h.Router.Typed != nil {
+		if finisherMethodCount > 0 || h.Router.Stream != nil {
+			return response.FailBackend("Router.Typed cannot be used with Stream or finisher methods")
+		}
+		return h.serveTyped(bindData, currentDB, response)
+	}
+
+	if h.Router.Stream != nil {
+		if finisherMethodCount > 0 || h.Router.Handler != nil {
+			return response.FailBackend("Router.Stream cannot be used with Handler or finisher methods")
+		}
+		return response.SucEvents(h.Router.Heartbeat, func(sink *bm.EventSink) error {
+			return h.Router.Stream(StreamParams{
+				W:          w,
+				R:          r,
+				BindReader: NewBinderReader(bindReader),
+				Principal:  principal,
+				DB:         currentDB.WithContext(r.Context()),
+				Sink:       sink,
+			})
+		})
+	}
+
 	if finisherMethodCount > 0 && h.Router.Model == nil {
 		fmt.Println("Router.Model cannot be nil when using finisher methods")
 		return response.FailBackend("Router.Model cannot be nil when using finisher methods")
 	}
 
 	// 处理各个 Finisher 方法。
+	if finisherMethodCount > 0 {
+		return h.serveFinisher(HandlerParams{
+			W:          w,
+			R:          r,
+			Ctx:        h.ctx,
+			BindReader: NewBinderReader(bindReader),
+			Principal:  principal,
+			Bind:       bindData,
+			Tx:         currentDB,
+			Res:        response,
+		}, bindReader)
+	}
+
+	if h.Router.Handler != nil {
+		currentDB.Transaction(func(tx *gorm.DB) error {
+			response = h.Router.Handler(HandlerParams{
+				W:          w,
+				R:          r,
+				Ctx:        h.ctx,
+				Res:        bm.NewRes(w).WithRequest(r),
+				Tx:         tx,
+				BindReader: NewBinderReader(bindReader),
+				Principal:  principal,
+				Bind:       bindData,
+			})
+
+			if response.Code != 200 {
+				return fmt.Errorf(response.Msg)
+			}
+
+			return nil
+		}, h.txOptions()...)
+	}
+
+	return response
+}
+
+// serveFinisher 处理 Finisher 方法，写操作在事务中执行，钩子与 Finisher 共享同一事务，返回错误响应时回滚。
+// params: 处理函数参数，Tx 为已应用 Scopes 的数据库会话。
+// bindReader: 绑定数据的结构体读取器。
+func (h *handler) serveFinisher(params HandlerParams, bindReader ds.FieldReader) *bm.Res {
+	if !h.isWriteFinisher() {
+		return h.finish(params, bindReader)
+	}
+
+	var result *bm.Res
+	err := params.Tx.Transaction(func(tx *gorm.DB) error {
+		params.Tx = tx
+		result = h.finish(params, bindReader)
+		if result.Code >= http.StatusBadRequest {
+			return errFinishAborted
+		}
+		return nil
+	}, h.txOptions()...)
+	if err != nil && !errors.Is(err, errFinishAborted) {
+		return params.Res.FailBackend(err)
+	}
+	return result
+}
+
+// finish 执行 Finisher 方法。
+func (h *handler) finish(params HandlerParams, bindReader ds.FieldReader) *bm.Res {
+	currentDB, r, response := params.Tx, params.R, params.Res
+
 	switch {
 	case h.Router.CreateOne != nil:
 		// 处理创建操作。
-		finisherParams, err := h.genCreateParams(bindReader)
+		finisherParams, err := h.genCreateParams(bindReader, h.Router.CreateOne)
 		if err != nil {
 			return response.FailFront(err)
 
 		}
-		if err := currentDB.Create(finisherParams).Error; err != nil {
+		if err := h.applyDataScope(currentDB, finisherParams); err != nil {
+			return response.FailBackend(err)
+		}
+		if res := h.before(params, finisherParams); res != nil {
+			return res
+		}
+		if err := currentDB.Session(&gorm.Session{NewDB: true}).Create(finisherParams).Error; err != nil {
 			return response.FailFront(err)
 		}
-		return response.SucJson(finisherParams)
+		return h.after(params, finisherParams)
+
+	case h.Router.Import != nil:
+		// 处理导入操作。
+		return h.serveImport(params)
 
 	case h.Router.UpdateOne != nil:
 		// 处理更新操作。
 		newModel := reflect.New(reflect.TypeOf(h.Router.Model)).Interface()
-		if err := currentDB.First(newModel).Error; err != nil {
+		if err := currentDB.Clauses(lockForUpdate).First(newModel).Error; err != nil {
 			return response.FailFront("No corresponding data")
 		}
+		if err := h.checkIfMatch(r, newModel); err != nil {
+			return response.Fail(err)
+		}
 
 		finisherParams, err := h.genUpdateParams(bindReader, newModel)
 		if err != nil {
 			return response.FailFront(err)
 		}
-		if err := db.DB.GORM.Save(finisherParams).Error; err != nil {
-			return response.FailFront(err)
+		if err := h.applyDataScope(currentDB, finisherParams); err != nil {
+			return response.FailBackend(err)
+		}
+		if res := h.before(params, finisherParams); res != nil {
+			return res
 		}
-		return response.SucJson(finisherParams)
+		// 写入时同样带上行级数据范围，只更新当前主键且属于当前范围的记录。
+		result := currentDB.Session(&gorm.Session{NewDB: true}).Scopes(h.dataScopeQuery).Model(finisherParams).Select("*").Updates(finisherParams)
+		if result.Error != nil {
+			return response.FailFront(result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return response.FailFront("No corresponding data")
+		}
+		return h.after(params, finisherParams)
 
 	case h.Router.DeleteOne:
 		// 处理删除操作。
 		newModel := reflect.New(reflect.TypeOf(h.Router.Model)).Interface()
-		if err := currentDB.First(newModel).Error; err != nil {
+		if err := currentDB.Clauses(lockForUpdate).First(newModel).Error; err != nil {
 			return response.FailFront("No corresponding data")
 
 		}
-		if err := currentDB.Delete(newModel).Error; err != nil {
+		if err := h.checkIfMatch(r, newModel); err != nil {
+			return response.Fail(err)
+		}
+		if res := h.before(params, newModel); res != nil {
+			return res
+		}
+		if err := currentDB.Session(&gorm.Session{NewDB: true}).Delete(newModel).Error; err != nil {
 			return response.FailFront(err)
 		}
-		return response.SucJson(newModel)
+		return h.after(params, newModel)
 
 	case h.Router.GetOne:
 		// 处理获取单个记录操作。
+		if res := h.before(params, nil); res != nil {
+			return res
+		}
+		selection, err := h.parseFields(r)
+		if err != nil {
+			return response.FailFront(err)
+		}
+		if selection != nil {
+			currentDB = currentDB.Select(selection.columns)
+		}
+
 		newModel := reflect.New(reflect.TypeOf(h.Router.Model)).Interface()
 		if err := currentDB.First(newModel).Error; err != nil {
 			return response.FailFront("No corresponding data")
 
 		}
-		return response.SucJson(newModel)
+		var data interface{} = newModel
+		if selection != nil {
+			if data, err = selection.tree.prune(newModel); err != nil {
+				return response.FailBackend(err)
+			}
+		}
+		data, res := h.transform(params, data)
+		if res != nil {
+			return res
+		}
+		if err := h.withValidators(response, data, newModel); err != nil {
+			return response.FailBackend(err)
+		}
+		return response.SucJson(data)
+
+	case h.Router.GetTree != nil:
+		// 处理获取树形列表操作。
+		if res := h.before(params, nil); res != nil {
+			return res
+		}
+		newModelSlice := reflect.New(reflect.SliceOf(reflect.TypeOf(h.Router.Model))).Interface()
+		if err := currentDB.Find(newModelSlice).Error; err != nil {
+			return response.FailBackend("Query failed")
+		}
+		tree, err := h.Router.GetTree.buildTree(newModelSlice, bindReader)
+		if err != nil {
+			return response.FailBackend(err)
+		}
+		return h.after(params, tree)
 
 	case h.Router.GetList:
 		// 处理获取列表操作。
+		if res := h.before(params, nil); res != nil {
+			return res
+		}
+		selection, err := h.parseFields(r)
+		if err != nil {
+			return response.FailFront(err)
+		}
+
+		if h.Router.Export {
+			if format := exportFormat(r); format != "" {
+				return h.export(currentDB, format, selection, response)
+			}
+		}
+		if h.Router.StreamList {
+			return h.streamList(currentDB, r, selection, response)
+		}
+
 		pagination := bm.Pagination{
 			PageSize: 10,
 			Current:  1,
@@ -161,44 +386,38 @@ func (h *handler) serveHTTP(w http.ResponseWriter, r *http.Request) *bm.Res {
 
 		}
 		if total == 0 {
-			return response.SucList(bm.ResList{
+			list := bm.ResList{
 				Pagination: pagination,
 				Data:       []interface{}{},
 				Total:      total,
-			})
+			}
+			return h.afterList(params, list)
 
 		}
 
 		currentDB = currentDB.Scopes(PaginationScope(pagination))
+		if selection != nil {
+			currentDB = currentDB.Select(selection.columns)
+		}
 		newModelSlice := reflect.New(reflect.SliceOf(reflect.TypeOf(h.Router.Model))).Interface()
 		if err := currentDB.Find(newModelSlice).Error; err != nil {
 			return response.FailBackend("Query failed")
 
 		}
 
-		return response.SucList(bm.ResList{
-			Pagination: pagination,
-			Data:       newModelSlice,
-			Total:      total,
-		})
-	}
-
-	if h.Router.Handler != nil {
-		currentDB.Transaction(func(tx *gorm.DB) error {
-			response = h.Router.Handler(HandlerParams{
-				W:          w,
-				R:          r,
-				Res:        bm.NewRes(w),
-				Tx:         tx,
-				BindReader: NewBinderReader(bindReader),
-			})
-
-			if response.Code != 200 {
-				return fmt.Errorf(response.Msg)
+		var listData interface{} = newModelSlice
+		if selection != nil {
+			if listData, err = selection.tree.prune(newModelSlice); err != nil {
+				return response.FailBackend(err)
 			}
+		}
 
-			return nil
-		})
+		list := bm.ResList{
+			Pagination: pagination,
+			Data:       listData,
+			Total:      total,
+		}
+		return h.afterList(params, list)
 	}
 
 	return response
@@ -206,8 +425,9 @@ func (h *handler) serveHTTP(w http.ResponseWriter, r *http.Request) *bm.Res {
 
 // genCreateParams 生成创建操作的参数。
 // bindReader: 绑定数据的结构体读取器。
+// mapping: 模型字段到绑定字段的映射。
 // 返回生成的模型实例或错误信息。
-func (h *handler) genCreateParams(bindReader ds.FieldReader) (interface{}, error) {
+func (h *handler) genCreateParams(bindReader ds.FieldReader, mapping map[string]string) (interface{}, error) {
 	newModel := reflect.New(reflect.TypeOf(h.Router.Model)).Interface()
 	modelReader, err := ds.NewStructReader(newModel)
 	if err != nil {
@@ -215,7 +435,7 @@ func (h *handler) genCreateParams(bindReader ds.FieldReader) (interface{}, error
 	}
 
 	modelMap := make(map[string]interface{})
-	for modelField, bindField := range h.Router.CreateOne {
+	for modelField, bindField := range mapping {
 		if _, err := modelReader.GetField(modelField); err != nil {
 			return nil, fmt.Errorf("model lacks field '%s'", modelField)
 		}
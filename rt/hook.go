@@ -0,0 +1,55 @@
+// Package rt 提供了 Finisher 前后的钩子。
+package rt
+
+import (
+	"errors"
+
+	"github.com/QingShan-Xu/web/bm"
+)
+
+// errFinishAborted 钩子或 Finisher 返回错误响应时用于回滚事务。
+var errFinishAborted = errors.New("finisher aborted")
+
+// before 调用 BeforeFinish 钩子。
+// model: 即将写入的模型，读取操作为 nil。
+// 返回非 nil 时中止操作。
+func (h *handler) before(params HandlerParams, model interface{}) *bm.Res {
+	if h.Router.BeforeFinish == nil {
+		return nil
+	}
+	return h.Router.BeforeFinish(params, model)
+}
+
+// transform 调用 AfterFinish 钩子转换结果。
+// result: Finisher 的结果。
+// 返回转换后的结果，中止时返回错误响应。
+func (h *handler) transform(params HandlerParams, result interface{}) (interface{}, *bm.Res) {
+	if h.Router.AfterFinish == nil {
+		return result, nil
+	}
+	return h.Router.AfterFinish(params, result)
+}
+
+// after 调用 AfterFinish 钩子并返回成功响应。
+func (h *handler) after(params HandlerParams, result interface{}) *bm.Res {
+	result, res := h.transform(params, result)
+	if res != nil {
+		return res
+	}
+	return params.Res.SucJson(result)
+}
+
+// afterList 调用 AfterFinish 钩子并返回列表响应，钩子返回 bm.ResList 以外的值时按普通数据返回。
+func (h *handler) afterList(params HandlerParams, list bm.ResList) *bm.Res {
+	result, res := h.transform(params, list)
+	if res != nil {
+		return res
+	}
+	if err := h.withValidators(params.Res, result, nil); err != nil {
+		return params.Res.FailBackend(err)
+	}
+	if list, ok := result.(bm.ResList); ok {
+		return params.Res.SucList(list)
+	}
+	return params.Res.SucJson(result)
+}
@@ -0,0 +1,294 @@
+// Package rt 提供了 CSV/Excel 批量导入功能。
+package rt
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/QingShan-Xu/web/bm"
+	"github.com/QingShan-Xu/web/ds"
+	"github.com/mitchellh/mapstructure"
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	ImportFileField = "file"   // 导入文件的表单字段名
+	ImportMaxMemory = 32 << 20 // 解析 multipart 表单时使用的最大内存
+	ImportBatchSize = 200      // 导入时每批插入的行数
+)
+
+// importColumn 导入列与模型、绑定字段的对应关系。
+type importColumn struct {
+	header     string // 列标题
+	modelField string // 模型字段名
+	bindKey    string // 绑定数据的键（bind 标签）
+}
+
+// serveImport 处理导入操作。
+// params: 处理函数参数，Tx 为已应用查询范围的数据库会话。
+func (h *handler) serveImport(params HandlerParams) *bm.Res {
+	currentDB, r, response := params.Tx, params.R, params.Res
+	if err := r.ParseMultipartForm(ImportMaxMemory); err != nil {
+		if limitErr, ok := limitError(err); ok {
+			return response.Fail(limitErr)
+		}
+		return response.FailFront(fmt.Errorf("failed to parse multipart form: %w", err))
+	}
+	file, fileHeader, err := r.FormFile(ImportFileField)
+	if err != nil {
+		return response.FailFront(fmt.Errorf("missing import file '%s': %w", ImportFileField, err))
+	}
+	defer file.Close()
+
+	records, err := readImportRecords(file, fileHeader.Filename)
+	if err != nil {
+		return response.FailFront(err)
+	}
+	if len(records) == 0 {
+		return response.FailFront("import file is empty")
+	}
+
+	columns, err := h.importColumns(records[0])
+	if err != nil {
+		return response.FailFront(err)
+	}
+
+	modelType := reflect.Indirect(reflect.ValueOf(h.Router.Model)).Type()
+	models := reflect.MakeSlice(reflect.SliceOf(reflect.PtrTo(modelType)), 0, len(records)-1)
+	report := bm.ImportReport{Errors: []bm.ImportRowError{}}
+
+	for i, record := range records[1:] {
+		if isBlankRecord(record) {
+			continue
+		}
+		report.Total++
+
+		// 表头为第 1 行，数据从第 2 行开始。
+		model, rowErrors := h.importRow(r, i+2, columns, record)
+		if len(rowErrors) > 0 {
+			report.Errors = append(report.Errors, rowErrors...)
+			continue
+		}
+		models = reflect.Append(models, reflect.ValueOf(model))
+	}
+
+	if len(report.Errors) > 0 {
+		response.FailFront(fmt.Sprintf("%d 行数据校验失败", len(report.Errors)))
+		response.Data = report
+		return response
+	}
+
+	if models.Len() > 0 {
+		// 已处于 serveFinisher 开启的事务中，任一行失败时整体回滚。
+		for i := 0; i < models.Len(); i++ {
+			if err := h.applyDataScope(currentDB, models.Index(i).Interface()); err != nil {
+				return response.FailBackend(err)
+			}
+			if res := h.before(params, models.Index(i).Interface()); res != nil {
+				return res
+			}
+		}
+		if err := currentDB.Session(&gorm.Session{NewDB: true}).CreateInBatches(models.Interface(), ImportBatchSize).Error; err != nil {
+			return response.FailBackend(err)
+		}
+	}
+
+	report.Success = models.Len()
+	return h.after(params, report)
+}
+
+// initImport 检查导入路由的配置，导入的每一行都按 Bind 绑定与校验，因此 Bind 不能为空。
+func initImport(router *Router) error {
+	if router.Import != nil && router.Bind == nil {
+		return fmt.Errorf("%s(%s): Router.Import requires Router.Bind to describe a row", router.completePath, router.completeName)
+	}
+	return nil
+}
+
+// importColumns 根据表头匹配模型字段，表头与导出列标题一致（label 标签，其次 json 标签，最后字段名）。
+// headers: 表头行。
+// 返回每一列的对应关系，空表头的列为零值；存在未在 Router.Import 中声明的列时返回错误。
+func (h *handler) importColumns(headers []string) ([]importColumn, error) {
+	modelType := reflect.Indirect(reflect.ValueOf(h.Router.Model)).Type()
+	byHeader := map[string]exportColumn{}
+	for _, column := range parseExportColumns(modelType) {
+		byHeader[column.header] = column
+		byHeader[column.json] = column
+		byHeader[column.name] = column
+	}
+
+	bindReader, err := ds.NewStructReader(h.Router.Bind)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([]importColumn, len(headers))
+	matched := 0
+	for i, header := range headers {
+		header = strings.TrimSpace(strings.TrimPrefix(header, "\xEF\xBB\xBF"))
+		if header == "" {
+			continue
+		}
+		// 文件不能写入未声明的字段，例如 id 与 created_at。
+		modelColumn, ok := byHeader[header]
+		if !ok {
+			return nil, fmt.Errorf("import column '%s' is not allowed", header)
+		}
+		bindField, ok := h.Router.Import[modelColumn.name]
+		if !ok {
+			return nil, fmt.Errorf("import column '%s' is not allowed", header)
+		}
+		columns[i] = importColumn{header: header, modelField: modelColumn.name, bindKey: bindKey(bindReader, bindField)}
+		matched++
+	}
+
+	if matched == 0 {
+		return nil, fmt.Errorf("import file has no column matching Router.Model")
+	}
+	return columns, nil
+}
+
+// importRow 将一行数据转换为模型实例，与 CreateOne 一样经过 Bind 的绑定、当前用户填充与校验。
+// r: HTTP 请求，用于读取当前用户。
+// rowNum: 行号。
+// columns: 列对应关系。
+// record: 行数据。
+// 返回模型实例或该行的错误列表。
+func (h *handler) importRow(r *http.Request, rowNum int, columns []importColumn, record []string) (interface{}, []bm.ImportRowError) {
+	var rowErrors []bm.ImportRowError
+	addError := func(column string, err interface{}) {
+		rowErrors = append(rowErrors, bm.ImportRowError{Row: rowNum, Column: column, Msg: fmt.Sprint(err)})
+	}
+
+	bindValue := reflect.New(reflect.TypeOf(h.Router.Bind))
+	bindValue.Elem().Set(reflect.ValueOf(h.Router.Bind))
+	bindData := bindValue.Interface()
+
+	headerByBindField := map[string]string{}
+	for i, column := range columns {
+		if column.bindKey == "" {
+			continue
+		}
+		headerByBindField[h.Router.Import[column.modelField]] = column.header
+		if i >= len(record) {
+			continue
+		}
+		if err := decodeImportValue(bindData, column.bindKey, record[i]); err != nil {
+			addError(column.header, err)
+		}
+	}
+	if len(rowErrors) > 0 {
+		return nil, rowErrors
+	}
+
+	// 填充当前用户，覆盖文件中的同名字段。
+	if err := newBinder().bindAuth(r, bindData); err != nil {
+		addError("", err)
+		return nil, rowErrors
+	}
+
+	for _, fieldError := range validateFields(bindData) {
+		column, ok := headerByBindField[fieldError.field]
+		if !ok {
+			column = ToSnakeCase(fieldError.field)
+		}
+		addError(column, strings.ReplaceAll(fieldError.msg, fieldError.field, column))
+	}
+	if len(rowErrors) > 0 {
+		return nil, rowErrors
+	}
+
+	bindReader, err := ds.NewStructReader(bindData)
+	if err != nil {
+		addError("", err)
+		return nil, rowErrors
+	}
+	model, err := h.genCreateParams(bindReader, h.Router.Import)
+	if err != nil {
+		addError("", err)
+		return nil, rowErrors
+	}
+	return model, nil
+}
+
+// bindKey 返回绑定字段对应的键，优先使用 bind 标签。
+func bindKey(bindReader ds.FieldReader, bindField string) string {
+	field, err := bindReader.GetField(bindField)
+	if err != nil {
+		return bindField
+	}
+	if tag, ok := field.GetTag()["bind"]; ok && tag.Value != "" {
+		return tag.Value
+	}
+	return bindField
+}
+
+// decodeImportValue 将单元格的值解码到结构体字段中，空单元格将被跳过。
+func decodeImportValue(result interface{}, key, value string) error {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	decoderConfig := &mapstructure.DecoderConfig{
+		Squash:           true,
+		WeaklyTypedInput: true,
+		TagName:          "bind",
+		Result:           result,
+		DecodeHook:       mapstructure.StringToTimeHookFunc(ExportTimeFmt),
+	}
+	decoder, _ := mapstructure.NewDecoder(decoderConfig)
+	err := decoder.Decode(map[string]interface{}{key: value})
+	if decodeErr, ok := err.(*mapstructure.Error); ok && len(decodeErr.Errors) > 0 {
+		return fmt.Errorf("%s", strings.Join(decodeErr.Errors, "; "))
+	}
+	return err
+}
+
+// readImportRecords 读取 CSV 或 Excel 文件的全部行。
+// file: 上传的文件。
+// fileName: 文件名，用于判断格式。
+func readImportRecords(file io.Reader, fileName string) ([][]string, error) {
+	switch strings.ToLower(strings.TrimPrefix(filepath.Ext(fileName), ".")) {
+	case ExportCSV:
+		body, err := io.ReadAll(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read import file: %w", err)
+		}
+		csvReader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(body, []byte("\xEF\xBB\xBF"))))
+		csvReader.FieldsPerRecord = -1
+		records, err := csvReader.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse csv file: %w", err)
+		}
+		return records, nil
+	case ExportXLSX:
+		xlsx, err := excelize.OpenReader(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse xlsx file: %w", err)
+		}
+		defer xlsx.Close()
+		records, err := xlsx.GetRows(xlsx.GetSheetName(0))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse xlsx file: %w", err)
+		}
+		return records, nil
+	default:
+		return nil, fmt.Errorf("unsupported import file '%s', expected .csv or .xlsx", fileName)
+	}
+}
+
+// isBlankRecord 检查是否为空行。
+func isBlankRecord(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,99 @@
+// Package rt 提供了请求超时与请求体大小限制。
+package rt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/QingShan-Xu/web/bm"
+)
+
+var (
+	defaultTimeout      time.Duration // 全局默认的请求超时，由 App.Timeout 配置
+	defaultMaxBodyBytes int64         // 全局默认的请求体大小限制，由 App.MaxBodyBytes 配置
+)
+
+// inherit 继承父级路由的 Timeout、MaxBodyBytes、Public、Roles、Permissions、DataScope 与 RateLimit，子路由设置了非零值时覆盖。
+// parent: 父级路由，根路由为 nil。
+func (r *Router) inherit(parent *Router) {
+	r.timeout, r.maxBodyBytes, r.public = r.Timeout, r.MaxBodyBytes, r.Public != nil && *r.Public
+	r.roles, r.permissions, r.dataScope, r.rateLimit = r.Roles, r.Permissions, r.DataScope, r.RateLimit
+	if parent == nil {
+		return
+	}
+	if r.Public == nil {
+		r.public = parent.public
+	}
+	if r.roles == nil {
+		r.roles = parent.roles
+	}
+	if r.permissions == nil {
+		r.permissions = parent.permissions
+	}
+	if r.dataScope == nil {
+		r.dataScope = parent.dataScope
+	}
+	if r.rateLimit == nil {
+		r.rateLimit = parent.rateLimit
+	}
+	if r.timeout == 0 {
+		r.timeout = parent.timeout
+	}
+	if r.maxBodyBytes == 0 {
+		r.maxBodyBytes = parent.maxBodyBytes
+	}
+}
+
+// limits 返回生效的请求超时与请求体大小限制，小于等于 0 表示不限制。
+func (h *handler) limits() (time.Duration, int64) {
+	timeout, maxBodyBytes := h.Router.timeout, h.Router.maxBodyBytes
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	if maxBodyBytes == 0 {
+		maxBodyBytes = defaultMaxBodyBytes
+	}
+	return timeout, maxBodyBytes
+}
+
+// applyLimits 限制请求体大小并为请求设置超时，Stream、WebSocket、StreamList 与导出等流式输出不设置超时。
+// w: HTTP 响应写入器。
+// r: HTTP 请求。
+// 返回带有超时的请求、取消函数，以及请求体超出限制时的错误响应。
+func (h *handler) applyLimits(w http.ResponseWriter, r *http.Request) (*http.Request, context.CancelFunc, *bm.Res) {
+	timeout, maxBodyBytes := h.limits()
+
+	if maxBodyBytes > 0 {
+		if r.ContentLength > maxBodyBytes {
+			return r, func() {}, bm.NewRes(w).WithRequest(r).Fail(bm.ErrBodyTooLarge)
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+	}
+
+	if timeout <= 0 || h.isStreaming(r) {
+		return r, func() {}, nil
+	}
+
+	// 读取请求体同样受超时限制，不支持设置读超时的 ResponseWriter 忽略该限制。
+	deadline := time.Now().Add(timeout)
+	http.NewResponseController(w).SetReadDeadline(deadline)
+	ctx, cancel := context.WithDeadline(r.Context(), deadline)
+	return r.WithContext(ctx), cancel, nil
+}
+
+// limitError 将读取请求体时超出大小限制或超时的错误转换为对应的 *bm.Error。
+func limitError(err error) (*bm.Error, bool) {
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		return bm.ErrBodyTooLarge, true
+	}
+	var netError net.Error
+	if errors.Is(err, os.ErrDeadlineExceeded) || errors.As(err, &netError) && netError.Timeout() {
+		return bm.ErrReadTimeout, true
+	}
+	return nil, false
+}
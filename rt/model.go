@@ -3,10 +3,15 @@ package rt
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/QingShan-Xu/web/db"
+	"gorm.io/gorm/schema"
 )
 
+// schemaCache 缓存已解析的模型 schema。
+var schemaCache = &sync.Map{}
+
 // generateDBModel 自动迁移数据库模型。
 // currentRouter: 当前路由器。
 // 返回错误信息（如果有）。
@@ -30,3 +35,14 @@ func generateDBModel(currentRouter *Router) error {
 
 	return nil
 }
+
+// parseModelSchema 解析模型的 GORM schema。
+// model: 数据库模型。
+// 返回解析后的 schema 或错误信息。
+func parseModelSchema(model interface{}) (*schema.Schema, error) {
+	modelSchema, err := schema.Parse(model, schemaCache, db.DB.GORM.NamingStrategy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse model schema: %w", err)
+	}
+	return modelSchema, nil
+}
@@ -17,13 +17,14 @@ func initCompletePathAndName(root *Router) {
 
 	root.completePath = root.Path
 	root.completeName = root.Name
+	root.inherit(nil)
 
 	// 输出根节点信息。
 	infoBuilder.WriteString(fmt.Sprintf("%s\n", root.Path))
 
 	// 遍历子节点，设置完整路径和名称。
-	for i, child := range root.Children {
-		depthFirstProcess(&child, root.Path, root.Name, "", i == len(root.Children)-1, &infoBuilder)
+	for i := range root.Children {
+		depthFirstProcess(&root.Children[i], root, "", i == len(root.Children)-1, &infoBuilder)
 	}
 
 	// 设置根节点的完整信息。
@@ -32,21 +33,21 @@ func initCompletePathAndName(root *Router) {
 
 // depthFirstProcess 深度优先遍历路由树。
 // current: 当前路由器。
-// currentPath: 当前路径。
-// currentName: 当前名称。
+// parent: 父级路由器。
 // prefix: 前缀字符串，用于显示树形结构。
 // isLast: 是否为同级的最后一个节点。
 // infoBuilder: 构建路由信息的字符串构建器。
-func depthFirstProcess(current *Router, currentPath, currentName, prefix string, isLast bool, infoBuilder *strings.Builder) {
+func depthFirstProcess(current, parent *Router, prefix string, isLast bool, infoBuilder *strings.Builder) {
 	// 计算并设置新的完整路径和名称。
-	newPath := removeTrailingSlash(fmt.Sprintf("%s%s", strings.TrimRight(currentPath, "/"), current.Path))
-	newName := strings.TrimRight(strings.TrimLeft(fmt.Sprintf("%s.%s", currentName, current.Name), "."), ".")
+	newPath := removeTrailingSlash(fmt.Sprintf("%s%s", strings.TrimRight(parent.completePath, "/"), current.Path))
+	newName := strings.TrimRight(strings.TrimLeft(fmt.Sprintf("%s.%s", parent.completeName, current.Name), "."), ".")
 
 	current.completePath = newPath
 	current.completeName = newName
+	current.inherit(parent)
 
 	// 格式化并记录当前节点信息。
-	infoLine := fmt.Sprintf("%s%s %s (%s) %s\n", prefix, treeSymbol(isLast), newPath, newName, current.Method)
+	infoLine := fmt.Sprintf("%s%s %s (%s) %s%s\n", prefix, treeSymbol(isLast), newPath, newName, current.Method, current.accessInfo())
 	infoBuilder.WriteString(infoLine)
 
 	// 获取子节点的前缀。
@@ -55,7 +56,7 @@ func depthFirstProcess(current *Router, currentPath, currentName, prefix string,
 	// 递归处理子节点。
 	for i := range current.Children {
 		child := &current.Children[i]
-		depthFirstProcess(child, newPath, newName, childPrefix, i == len(current.Children)-1, infoBuilder)
+		depthFirstProcess(child, current, childPrefix, i == len(current.Children)-1, infoBuilder)
 	}
 }
 
@@ -87,6 +88,40 @@ func generateChildPrefix(prefix string, isLast bool) string {
 	return prefix + "│   "
 }
 
+// CompleteInfo 返回 Register 生成的路由树信息，包括各路由的访问控制。
+func (r *Router) CompleteInfo() string {
+	return r.completeInfo
+}
+
+// RouteInfo 叶子路由的信息，可用于生成接口文档。
+type RouteInfo struct {
+	Method      string
+	Path        string
+	Name        string
+	Public      bool
+	Roles       []string
+	Permissions []string
+}
+
+// Routes 返回 Register 处理后的全部叶子路由。
+func (r *Router) Routes() []RouteInfo {
+	var routes []RouteInfo
+	if !isGroup(*r) {
+		routes = append(routes, RouteInfo{
+			Method:      r.Method,
+			Path:        r.completePath,
+			Name:        r.completeName,
+			Public:      r.public,
+			Roles:       r.roles,
+			Permissions: r.permissions,
+		})
+	}
+	for i := range r.Children {
+		routes = append(routes, r.Children[i].Routes()...)
+	}
+	return routes
+}
+
 // displayCompleteInfo 输出给定路由节点的完整树形结构信息。
 // node: 路由器节点。
 func displayCompleteInfo(node *Router) {
@@ -0,0 +1,132 @@
+// Package rt 提供了路由级别的限流。
+package rt
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QingShan-Xu/web/au"
+	"github.com/QingShan-Xu/web/bm"
+	"github.com/go-chi/httprate"
+)
+
+const (
+	RateLimitByIP          = "ip"      // 按客户端 IP 限流
+	RateLimitByUser        = "user"    // 按认证用户限流，未认证时按 IP
+	RateLimitByAPIKey      = "api_key" // 按 API Key 限流，未使用 API Key 时按 IP
+	RateLimitByHeader      = "header:" // 按请求头限流，例如 "header:X-Device-ID"，请求头为空时按 IP
+	DefaultRateLimitWindow = time.Minute
+	RateLimitResetHeader   = "RateLimit-Reset" // 距离配额重置的秒数
+)
+
+// rateLimitHeaders 标准的 RateLimit-* 响应头，RateLimit-Reset 由 allow 以秒数写出。
+var rateLimitHeaders = httprate.ResponseHeaders{
+	Limit:      "RateLimit-Limit",
+	Remaining:  "RateLimit-Remaining",
+	RetryAfter: "Retry-After",
+}
+
+// RateLimit 路由的限流配置，子路由未设置时继承，每个路由单独计数。
+type RateLimit struct {
+	Requests int                                   // 每个窗口允许的请求次数
+	Window   time.Duration                         // 窗口长度，默认 DefaultRateLimitWindow
+	Key      string                                // 限流维度，RateLimitByIP（默认）、RateLimitByUser、RateLimitByAPIKey 或 RateLimitByHeader
+	KeyFunc  func(r *http.Request) (string, error) // 自定义限流维度，设置后忽略 Key
+	Error    *bm.Error                             // 超过限制时的错误，默认 bm.ErrTooManyRequests
+
+	once    sync.Once
+	limiter *httprate.RateLimiter
+}
+
+// rateLimitWriter 记录限流计数失败的错误，由 allow 统一返回错误响应。
+type rateLimitWriter struct {
+	http.ResponseWriter
+	err error
+}
+
+// recordRateLimitError 替代 httprate 默认的错误处理，只记录错误而不写出响应。
+func recordRateLimitError(w http.ResponseWriter, r *http.Request, err error) {
+	if rw, ok := w.(*rateLimitWriter); ok {
+		rw.err = err
+	}
+}
+
+// window 返回窗口长度。
+func (l *RateLimit) window() time.Duration {
+	if l.Window <= 0 {
+		return DefaultRateLimitWindow
+	}
+	return l.Window
+}
+
+// key 返回请求的限流维度。
+func (l *RateLimit) key(r *http.Request) (string, error) {
+	if l.KeyFunc != nil {
+		return l.KeyFunc(r)
+	}
+	principal, ok := au.FromContext(r.Context())
+	switch {
+	case l.Key == RateLimitByUser && ok:
+		return "user:" + principal.ID, nil
+	case l.Key == RateLimitByAPIKey && ok && principal.APIKey != nil:
+		return "api_key:" + principal.APIKey.ID, nil
+	case strings.HasPrefix(l.Key, RateLimitByHeader):
+		if value := r.Header.Get(strings.TrimPrefix(l.Key, RateLimitByHeader)); value != "" {
+			return l.Key + ":" + value, nil
+		}
+	}
+	return httprate.KeyByIP(r)
+}
+
+// allow 消耗一次配额并写出 RateLimit-* 响应头，超过限制时返回错误响应。
+// 限流响应总是写入真实的 HTTP 状态码，使客户端与代理能够按 429 退避。
+// w: HTTP 响应写入器。
+// r: HTTP 请求。
+// scope: 计数的范围，例如路由的完整名称。
+func (l *RateLimit) allow(w http.ResponseWriter, r *http.Request, scope string) *bm.Res {
+	window := l.window()
+	l.once.Do(func() {
+		l.limiter = httprate.NewRateLimiter(l.Requests, window,
+			httprate.WithResponseHeaders(rateLimitHeaders),
+			httprate.WithErrorHandler(recordRateLimitError),
+		)
+	})
+
+	response := bm.NewRes(w).WithRequest(r).WithRealStatus(true)
+	key, err := l.key(r)
+	if err != nil {
+		return response.FailBackend(err)
+	}
+
+	now := time.Now()
+	reset := int(math.Ceil(now.Truncate(window).Add(window).Sub(now).Seconds()))
+	w.Header().Set(RateLimitResetHeader, fmt.Sprint(reset))
+	rw := &rateLimitWriter{ResponseWriter: w}
+	if !l.limiter.OnLimit(rw, r, scope+"|"+key) {
+		return nil
+	}
+	if rw.err != nil {
+		return response.FailBackend(rw.err)
+	}
+
+	w.Header().Set(rateLimitHeaders.RetryAfter, fmt.Sprint(reset))
+	if l.Error != nil {
+		return response.Fail(l.Error)
+	}
+	return response.Fail(bm.ErrTooManyRequests)
+}
+
+// Handler 返回按该配置对全部请求限流的中间件。
+func (l *RateLimit) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if res := l.allow(w, r, "*"); res != nil {
+			res.Send()
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
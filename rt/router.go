@@ -2,15 +2,18 @@
 package rt
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"time"
 
+	"github.com/QingShan-Xu/web/au"
 	"github.com/QingShan-Xu/web/bm"
+	"github.com/QingShan-Xu/web/ws"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"github.com/go-chi/httprate"
 	"github.com/spf13/viper"
 	"gorm.io/gorm"
 )
@@ -18,17 +21,44 @@ import (
 type HandlerParams struct {
 	W          http.ResponseWriter
 	R          *http.Request
+	Ctx        context.Context // 请求上下文，设置了 QueryTimeout 时带有超时
 	BindReader BindReader
+	Principal  *au.Principal // 当前认证的用户，未认证时为 nil
+	Bind       interface{}   // 绑定并校验后的结构体指针，没有 Bind 时为 nil
 	Tx         *gorm.DB
 	Res        *bm.Res
 }
 
+// StreamParams 是 Stream 处理函数的参数。
+type StreamParams struct {
+	W          http.ResponseWriter
+	R          *http.Request
+	BindReader BindReader
+	Principal  *au.Principal // 当前认证的用户，未认证时为 nil
+	DB         *gorm.DB      // 已应用 Scopes 的数据库会话，连接可能长时间保持，不开启事务
+	Sink       *bm.EventSink // 事件推送器
+}
+
+// WebSocketParams 是 WebSocket 处理函数的参数。
+type WebSocketParams struct {
+	R          *http.Request
+	BindReader BindReader
+	Principal  *au.Principal // 当前认证的用户，未认证时为 nil
+	DB         *gorm.DB      // 已应用 Scopes 的数据库会话，不开启事务
+	Conn       *ws.Conn      // 已升级的连接
+}
+
 // Router 定义了路由器结构体。
 type Router struct {
 	Name          string                                 // 路由名称
 	Path          string                                 // 路由路径
 	Method        string                                 // 请求方法
 	Handler       func(HandlerParams) *bm.Res            // 处理函数
+	Typed         TypedHandler                           // 泛型处理函数，使用 Handle 创建，Bind 为空时使用其请求类型
+	Stream        func(StreamParams) error               // Server-Sent Events 处理函数，返回或客户端断开后结束连接
+	Heartbeat     time.Duration                          // Stream 的心跳间隔，默认 15 秒
+	WebSocket     func(WebSocketParams) error            // WebSocket 处理函数，Bind 在升级前完成，返回后关闭连接
+	Origins       []string                               // WebSocket 允许的 Origin，为空时仅允许同源
 	Bind          interface{}                            // 请求参数绑定结构体
 	Model         interface{}                            // 数据库模型
 	NoAutoMigrate bool                                   // 是否自动迁移模型
@@ -39,16 +69,42 @@ type Router struct {
 	Where   [][]string
 	Preload [][]string
 	Order   []string
+	Fields  []string // 客户端可通过 fields 参数选择的字段（json 名称），为空时允许全部字段
+
+	CreateOne  map[string]string // 创建操作字段映射
+	Import     map[string]string // 导入操作字段映射，Bind 描述单行数据且不能为空，文件只能包含映射中的列
+	UpdateOne  map[string]string // 更新操作字段映射
+	DeleteOne  bool              // 是否为删除操作
+	GetOne     bool              // 是否获取单个记录
+	GetList    bool              // 是否获取列表
+	GetTree    *Tree             // 获取树形列表
+	Export     bool              // GetList 是否支持 format=csv|xlsx 导出全部数据
+	ETag       bool              // GetOne/GetList 返回 ETag 与 Last-Modified 并处理条件请求，UpdateOne/DeleteOne 要求携带 If-Match
+	Cache      *Cache            // GET 响应缓存，同一 Model 的写操作成功后自动失效
+	StreamList bool              // GetList 是否以流式输出全部数据，format=ndjson 或 Accept: application/x-ndjson 时输出 NDJSON，否则输出 JSON 数组
 
-	CreateOne map[string]string // 创建操作字段映射
-	UpdateOne map[string]string // 更新操作字段映射
-	DeleteOne bool              // 是否为删除操作
-	GetOne    bool              // 是否获取单个记录
-	GetList   bool              // 是否获取列表
+	Timeout      time.Duration                                           // 请求超时，子路由未设置时继承，小于 0 表示不限制，默认使用 App.Timeout 配置
+	Public       *bool                                                   // 是否允许未认证访问，为 nil 时继承父级，子路由可设置为 false 关闭；声明了 Roles 或 Permissions 时仍然校验
+	Roles        []string                                                // 允许访问的角色，拥有任一角色即可，子路由未设置时继承
+	Permissions  []string                                                // 访问所需的全部权限，子路由未设置时继承
+	RateLimit    *RateLimit                                              // 限流配置，子路由未设置时继承，每个路由单独计数
+	DataScope    [][]string                                              // 行级数据范围，{"列名", "用户信息名"}，例如 {"tenant_id", "tenant_id"}，作用于全部查询与写入，子路由未设置时继承
+	MaxBodyBytes int64                                                   // 请求体大小限制，子路由未设置时继承，小于 0 表示不限制，默认使用 App.MaxBodyBytes 配置
+	QueryTimeout time.Duration                                           // 数据库查询超时，默认使用 App.QueryTimeout 配置，不作用于 Stream、WebSocket、StreamList 与导出
+	Isolation    sql.IsolationLevel                                      // 事务隔离级别，默认使用 App.TxIsolation 配置
+	BeforeFinish func(HandlerParams, interface{}) *bm.Res                // Finisher 执行前调用，参数为即将写入的模型（读取操作为 nil），返回非 nil 时中止
+	AfterFinish  func(HandlerParams, interface{}) (interface{}, *bm.Res) // Finisher 执行后调用，可转换结果，返回非 nil 的 *bm.Res 时中止
 
-	completePath string // 完整路径
-	completeName string // 完整名称
-	completeInfo string // 路由信息
+	completePath string        // 完整路径
+	completeName string        // 完整名称
+	completeInfo string        // 路由信息
+	timeout      time.Duration // 继承后的请求超时
+	maxBodyBytes int64         // 继承后的请求体大小限制
+	public       bool          // 继承后的 Public
+	roles        []string      // 继承后的 Roles
+	permissions  []string      // 继承后的 Permissions
+	dataScope    [][]string    // 继承后的 DataScope
+	rateLimit    *RateLimit    // 继承后的 RateLimit
 }
 
 // Register 函数注册路由并返回 chi.Router。
@@ -77,6 +133,7 @@ func Register(rootRouter *Router) (*chi.Mux, error) {
 	useNoCache := viper.GetBool("App.NoCache")
 	useRedirectSlashes := viper.GetBool("App.RedirectSlashes")
 	LimitByMinuteIP := viper.GetInt("App.LimitByMinuteIP")
+	useCompress := viper.GetBool("App.Compress")
 
 	if usePing != "" {
 		chiRouter.Use(middleware.Heartbeat(usePing))
@@ -89,9 +146,50 @@ func Register(rootRouter *Router) (*chi.Mux, error) {
 		chiRouter.Use(middleware.RedirectSlashes)
 	}
 	if LimitByMinuteIP != 0 {
-		chiRouter.Use(httprate.LimitByIP(LimitByMinuteIP, 1*time.Minute))
+		chiRouter.Use((&RateLimit{Requests: LimitByMinuteIP, Window: time.Minute, Key: RateLimitByIP}).Handler)
+	}
+	// 响应压缩，CompressTypes 为空时使用 DefaultCompressTypes。
+	if useCompress {
+		compressLevel := viper.GetInt("App.CompressLevel")
+		if err := validCompressLevel(compressLevel); err != nil {
+			return nil, fmt.Errorf("App.CompressLevel: %w", err)
+		}
+		chiRouter.Use(Compress(
+			compressLevel,
+			viper.GetInt("App.CompressMinSize"),
+			viper.GetStringSlice("App.CompressTypes")...,
+		))
+	}
+
+	// 请求超时、请求体大小限制与数据库查询超时。
+	defaultTimeout = viper.GetDuration("App.Timeout")
+	defaultMaxBodyBytes = viper.GetInt64("App.MaxBodyBytes")
+	defaultQueryTimeout = viper.GetDuration("App.QueryTimeout")
+
+	// 事务隔离级别。
+	isolation, err := ParseIsolation(viper.GetString("App.TxIsolation"))
+	if err != nil {
+		return nil, err
+	}
+	defaultIsolation = isolation
+
+	// 默认缓存存储的容量。
+	if cacheSize := viper.GetInt("App.CacheSize"); cacheSize > 0 {
+		DefaultCacheStore = NewMemoryCache(cacheSize)
 	}
 
+	// 响应格式配置。
+	bm.SetConfig(bm.Config{
+		RealStatus:    viper.GetBool("Res.RealStatus"),
+		NoEnvelope:    viper.GetBool("Res.NoEnvelope"),
+		Problem:       viper.GetBool("Res.Problem"),
+		CodeField:     viper.GetString("Res.CodeField"),
+		ErrCodeField:  viper.GetString("Res.ErrCodeField"),
+		MsgField:      viper.GetString("Res.MsgField"),
+		DataField:     viper.GetString("Res.DataField"),
+		CallbackField: viper.GetString("Res.CallbackField"),
+	})
+
 	if err := generateChiRouter(rootRouter, chiRouter); err != nil {
 		return nil, fmt.Errorf("error generating router: %w", err)
 	}
@@ -125,6 +223,8 @@ func generateChiRouter(currentRouter *Router, parentChiRouter chi.Router) error
 	isGroup := isGroup(*currentRouter)
 
 	if currentRouter.Path != "" && isGroup {
+		// 子路由的错误全部收集后返回，出错的子路由不影响其余子路由的处理。
+		var childErrs []error
 		// 为当前组定义一个新的子路由。
 		parentChiRouter.Route(currentRouter.Path, func(subRouter chi.Router) {
 			// 应用中间件。
@@ -132,17 +232,25 @@ func generateChiRouter(currentRouter *Router, parentChiRouter chi.Router) error
 
 			// 递归处理子路由。
 			for i := range currentRouter.Children {
-				child := &currentRouter.Children[i]
-				if err := generateChiRouter(child, subRouter); err != nil {
-					log.Printf("Error processing child router %s(%s): %v", child.completePath, child.completeName, err)
-					return
+				if err := generateChiRouter(&currentRouter.Children[i], subRouter); err != nil {
+					childErrs = append(childErrs, err)
 				}
 			}
 		})
+		if err := errors.Join(childErrs...); err != nil {
+			return err
+		}
+	}
+
+	if err := initTypedBind(currentRouter); err != nil {
+		return err
+	}
+	if err := initImport(currentRouter); err != nil {
+		return err
 	}
 
 	if currentRouter.Path != "" && !isGroup {
-		parentChiRouter.Method(currentRouter.Method, currentRouter.Path, currentRouter)
+		parentChiRouter.With(currentRouter.Middlewares...).Method(currentRouter.Method, currentRouter.Path, currentRouter)
 	}
 
 	return nil
@@ -153,8 +261,45 @@ func generateChiRouter(currentRouter *Router, parentChiRouter chi.Router) error
 // req: HTTP 请求。
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	handler := &handler{Router: r}
-	res := handler.serveHTTP(w, req)
+	req, cancelTimeout, res := handler.applyLimits(w, req)
+	defer cancelTimeout()
+	if res != nil {
+		res.Send()
+		return
+	}
+	if handler.Router.rateLimit != nil {
+		if res := handler.Router.rateLimit.allow(w, req, r.completeName); res != nil {
+			res.Send()
+			return
+		}
+	}
+	if err := handler.checkAccess(req); err != nil {
+		bm.NewRes(w).WithRequest(req).Fail(err).Send()
+		return
+	}
+
+	ctx, cancel := handler.queryContext(req)
+	defer cancel()
+	handler.ctx = ctx
+
+	if r.Cache != nil && req.Method == http.MethodGet && !isUpgrade(req) {
+		handler.recorder = &cacheRecorder{ResponseWriter: w}
+		w = handler.recorder
+	}
+
+	res = handler.serveHTTP(w, req)
+	// 读取请求体超时已返回 408，其余失败因超时导致时返回 503。
+	if res.Code >= http.StatusBadRequest && res.Code != http.StatusRequestTimeout && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		res.Fail(bm.ErrTimeout)
+	}
 	res.Send()
+
+	if handler.recorder != nil {
+		handler.recorder.save(handler, res.Code)
+	}
+	if handler.isWriteFinisher() && res.Code > 0 && res.Code < http.StatusBadRequest {
+		handler.invalidateCache()
+	}
 }
 
 // isGroup 检查路由器是否为组路由。
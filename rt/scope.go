@@ -0,0 +1,88 @@
+// Package rt 提供了根据当前用户限制可访问数据行的行级数据范围。
+package rt
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"github.com/QingShan-Xu/web/au"
+	"github.com/QingShan-Xu/web/bm"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DataScoper 由模型实现，声明模型的行级数据范围，与 Router.DataScope 一同生效。
+type DataScoper interface {
+	// DataScope 返回 {"列名", "用户信息名"} 形式的规则，用户信息名与 auth 标签相同。
+	DataScope() [][]string
+}
+
+// dataScopeValue 解析后的行级数据范围条件。
+type dataScopeValue struct {
+	column string
+	value  interface{}
+}
+
+// resolveDataScope 根据当前用户解析路由与模型声明的行级数据范围，结果保存在 h.dataScope。
+// 声明了数据范围但没有认证用户时返回 bm.ErrUnauthorized，用户缺少对应信息时返回 bm.ErrForbidden。
+// r: HTTP 请求。
+func (h *handler) resolveDataScope(r *http.Request) error {
+	rules := h.Router.dataScope
+	if h.Router.Model != nil {
+		if scoper, ok := reflect.New(reflect.TypeOf(h.Router.Model)).Interface().(DataScoper); ok {
+			rules = append(rules[:len(rules):len(rules)], scoper.DataScope()...)
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	principal, ok := au.FromContext(r.Context())
+	if !ok {
+		return bm.ErrUnauthorized
+	}
+	for _, rule := range rules {
+		if len(rule) != 2 {
+			return fmt.Errorf("data scope rule must be {column, principal value}, got %v", rule)
+		}
+		value, ok := principal.Value(rule[1])
+		if !ok {
+			return bm.ErrForbidden
+		}
+		h.dataScope = append(h.dataScope, dataScopeValue{column: rule[0], value: value})
+	}
+	return nil
+}
+
+// dataScopeQuery 将行级数据范围作为当前表的查询条件。
+func (h *handler) dataScopeQuery(tx *gorm.DB) *gorm.DB {
+	for _, scope := range h.dataScope {
+		tx = tx.Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: scope.column}, Value: scope.value})
+	}
+	return tx
+}
+
+// applyDataScope 将行级数据范围写入模型，覆盖请求中的同名字段。
+// currentDB: 数据库会话，用于解析模型。
+// model: 模型指针。
+func (h *handler) applyDataScope(currentDB *gorm.DB, model interface{}) error {
+	if len(h.dataScope) == 0 {
+		return nil
+	}
+	statement := &gorm.Statement{DB: currentDB}
+	if err := statement.Parse(model); err != nil {
+		return err
+	}
+	for _, scope := range h.dataScope {
+		field := statement.Schema.LookUpField(scope.column)
+		if field == nil {
+			return fmt.Errorf("model lacks data scope column '%s'", scope.column)
+		}
+		if err := field.Set(context.Background(), reflect.ValueOf(model).Elem(), scope.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
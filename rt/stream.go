@@ -0,0 +1,116 @@
+// Package rt 提供了 GetList 的流式输出功能。
+package rt
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/QingShan-Xu/web/bm"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	StreamBatchSize = 500      // 流式输出时每批查询的行数
+	StreamNDJSON    = "ndjson" // format 参数取该值时以 NDJSON 输出
+)
+
+// streamFormat 根据 format 参数或 Accept 头部判断流式输出格式，默认输出 JSON 数组。
+func streamFormat(r *http.Request) bm.StreamFormat {
+	if strings.ToLower(r.URL.Query().Get(ExportQuery)) == StreamNDJSON ||
+		strings.Contains(r.Header.Get("Accept"), bm.ContentTypeNDJSON) {
+		return bm.StreamNDJSON
+	}
+	return bm.StreamJSONArray
+}
+
+// eachRow 按路由的排序逐行回调，同一时刻只持有一批数据。
+// 先以游标按当前查询条件与排序读取主键，再按每批主键查询完整数据，使 Order 与 Preload 均保持生效。
+// currentDB: 已应用查询条件的数据库会话。
+// batchSize: 每批查询的行数。
+// fn: 每行调用一次，参数为模型值。
+func (h *handler) eachRow(currentDB *gorm.DB, batchSize int, fn func(row reflect.Value) error) error {
+	modelType := reflect.Indirect(reflect.ValueOf(h.Router.Model)).Type()
+	statement := &gorm.Statement{DB: currentDB}
+	if err := statement.Parse(reflect.New(modelType).Interface()); err != nil {
+		return err
+	}
+	primaryKey := statement.Schema.PrioritizedPrimaryField
+	if primaryKey == nil {
+		return fmt.Errorf("model %s has no primary key", modelType.Name())
+	}
+	primaryColumn := clause.Column{Table: clause.CurrentTable, Name: primaryKey.DBName}
+
+	rows, err := currentDB.Session(&gorm.Session{}).Model(reflect.New(modelType).Interface()).Select("?", primaryColumn).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	keys := make([]interface{}, 0, batchSize)
+	flush := func() error {
+		if len(keys) == 0 {
+			return nil
+		}
+		batch := reflect.New(reflect.SliceOf(modelType))
+		if err := currentDB.Session(&gorm.Session{}).Where(clause.IN{Column: primaryColumn, Values: keys}).Find(batch.Interface()).Error; err != nil {
+			return err
+		}
+		keys = keys[:0]
+		items := batch.Elem()
+		for i := 0; i < items.Len(); i++ {
+			if err := fn(items.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for rows.Next() {
+		key := reflect.New(primaryKey.FieldType)
+		if err := rows.Scan(key.Interface()); err != nil {
+			return err
+		}
+		keys = append(keys, key.Elem().Interface())
+		if len(keys) == batchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return flush()
+}
+
+// isStreaming 判断请求是否为长时间输出的路由，包括 Stream、WebSocket、StreamList 与导出，不受请求超时与查询超时限制。
+func (h *handler) isStreaming(r *http.Request) bool {
+	return h.Router.Stream != nil || h.Router.WebSocket != nil ||
+		h.Router.GetList && (h.Router.StreamList || h.Router.Export && exportFormat(r) != "")
+}
+
+// streamList 以流式方式输出全部数据，忽略分页参数。
+// currentDB: 已应用查询条件的数据库会话。
+// selection: 字段选择，为 nil 时输出全部字段。
+// response: 响应。
+func (h *handler) streamList(currentDB *gorm.DB, r *http.Request, selection *fieldSelection, response *bm.Res) *bm.Res {
+	if selection != nil {
+		currentDB = currentDB.Select(selection.columns)
+	}
+
+	return response.SucStream(streamFormat(r), func(emit func(row interface{}) error) error {
+		return h.eachRow(currentDB, StreamBatchSize, func(row reflect.Value) error {
+			if selection == nil {
+				return emit(row.Interface())
+			}
+			data, err := selection.tree.prune(row.Interface())
+			if err != nil {
+				return err
+			}
+			return emit(data)
+		})
+	})
+}
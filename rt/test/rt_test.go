@@ -0,0 +1,1383 @@
+package rt_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/QingShan-Xu/web/au"
+	"github.com/QingShan-Xu/web/bm"
+	"github.com/QingShan-Xu/web/db"
+	"github.com/QingShan-Xu/web/ds"
+	"github.com/QingShan-Xu/web/rt"
+	"github.com/glebarez/sqlite"
+	"github.com/gorilla/websocket"
+	"github.com/spf13/viper"
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+// Pet 测试使用的模型，sqlite 中 bm.Model 的 integer(11) 主键不会自增，因此单独声明主键
+type Pet struct {
+	ID       int    `gorm:"primarykey" json:"id"`
+	Name     string `json:"name"`
+	TenantID string `json:"tenant_id"`
+}
+
+// Category 测试树形列表使用的模型
+type Category struct {
+	ID       int    `gorm:"primarykey" json:"id"`
+	Name     string `json:"name"`
+	ParentID *int   `json:"parent_id"`
+}
+
+// newServer 使用独立的内存数据库注册路由，返回注册后的处理器
+func newServer(t *testing.T, router *rt.Router, config map[string]interface{}) http.Handler {
+	t.Helper()
+	viper.Reset()
+	for key, value := range config {
+		viper.Set(key, value)
+	}
+	t.Cleanup(viper.Reset)
+
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", strings.ReplaceAll(t.Name(), "/", "_"))
+	gormDB, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		NamingStrategy: schema.NamingStrategy{SingularTable: true},
+		Logger:         logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	// 关闭最后一个连接后内存数据库被删除，重复运行测试时从空库开始
+	t.Cleanup(func() {
+		if sqlDB, err := gormDB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	db.DB.GORM = gormDB
+
+	mux, err := rt.Register(router)
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	return mux
+}
+
+// seed 写入测试数据
+func seed(t *testing.T, rows interface{}) {
+	t.Helper()
+	if err := db.DB.GORM.CreateInBatches(rows, 100).Error; err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+}
+
+// do 发送请求并返回响应
+func do(handler http.Handler, method, target, body string, header http.Header) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	r := httptest.NewRequest(method, target, reader)
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	for key, values := range header {
+		for _, value := range values {
+			r.Header.Add(key, value)
+		}
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+// upload 以 multipart 表单上传导入文件并返回响应
+func upload(handler http.Handler, target, fileName, content string, header http.Header) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, _ := form.CreateFormFile(rt.ImportFileField, fileName)
+	io.WriteString(file, content)
+	form.Close()
+
+	r := httptest.NewRequest(http.MethodPost, target, &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	for key, values := range header {
+		for _, value := range values {
+			r.Header.Add(key, value)
+		}
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+// envelope 解析响应信封
+func envelope(t *testing.T, w *httptest.ResponseRecorder) (code int, msg string, data json.RawMessage) {
+	t.Helper()
+	var body struct {
+		Code int             `json:"code"`
+		Msg  string          `json:"msg"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Unmarshal %q: %v", w.Body.String(), err)
+	}
+	return body.Code, body.Msg, body.Data
+}
+
+// ndjsonNames 解析 NDJSON 响应中每行的名称
+func ndjsonNames(t *testing.T, w *httptest.ResponseRecorder) []string {
+	t.Helper()
+	var names []string
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var pet Pet
+		if err := json.Unmarshal(scanner.Bytes(), &pet); err != nil {
+			t.Fatalf("Unmarshal %q: %v", scanner.Text(), err)
+		}
+		names = append(names, pet.Name)
+	}
+	return names
+}
+
+// TestStreamOrder 测试带排序的流式列表与导出按排序输出全部数据且不重复
+func TestStreamOrder(t *testing.T) {
+	const total = rt.StreamBatchSize*2 + 7
+	handler := newServer(t, &rt.Router{Path: "/", Children: []rt.Router{
+		{Name: "stream", Path: "/stream", Method: http.MethodGet, Model: Pet{}, GetList: true, StreamList: true, Order: []string{"name"}},
+		{Name: "timeout", Path: "/timeout", Method: http.MethodGet, Model: Pet{}, GetList: true, StreamList: true, Order: []string{"name"}, Timeout: time.Nanosecond, QueryTimeout: time.Nanosecond},
+		{Name: "export", Path: "/export", Method: http.MethodGet, Model: Pet{}, GetList: true, Export: true, Order: []string{"name"}},
+	}}, nil)
+
+	// 主键递增而名称递减，排序与主键顺序相反
+	pets := make([]Pet, total)
+	for i := range pets {
+		pets[i].Name = fmt.Sprintf("pet-%04d", total-i)
+	}
+	seed(t, pets)
+
+	check := func(t *testing.T, names []string) {
+		t.Helper()
+		if len(names) != total {
+			t.Fatalf("Expected %d rows, got %d", total, len(names))
+		}
+		for i, name := range names {
+			if expected := fmt.Sprintf("pet-%04d", i+1); name != expected {
+				t.Fatalf("Row %d: expected %s, got %s", i, expected, name)
+			}
+		}
+	}
+
+	// 子测试 1：NDJSON 流式列表
+	t.Run("StreamList", func(t *testing.T) {
+		w := do(handler, http.MethodGet, "/stream?format=ndjson", "", nil)
+		check(t, ndjsonNames(t, w))
+	})
+
+	// 子测试 2：流式列表不受请求超时与查询超时限制
+	t.Run("NoTimeout", func(t *testing.T) {
+		w := do(handler, http.MethodGet, "/timeout?format=ndjson", "", nil)
+		check(t, ndjsonNames(t, w))
+	})
+
+	// 子测试 3：CSV 导出
+	t.Run("Export", func(t *testing.T) {
+		w := do(handler, http.MethodGet, "/export?format=csv", "", nil)
+		lines := strings.Split(strings.TrimSpace(strings.TrimPrefix(w.Body.String(), "\ufeff")), "\n")
+		header := strings.Split(strings.TrimSpace(lines[0]), ",")
+		column := -1
+		for i, name := range header {
+			if name == "name" {
+				column = i
+			}
+		}
+		if column < 0 {
+			t.Fatalf("Missing name column in %q", lines[0])
+		}
+		var names []string
+		for _, line := range lines[1:] {
+			names = append(names, strings.Split(strings.TrimSpace(line), ",")[column])
+		}
+		check(t, names)
+	})
+}
+
+// TestLeafMiddlewares 测试叶子路由的中间件只作用于该路由
+func TestLeafMiddlewares(t *testing.T) {
+	mark := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Mark", "leaf")
+			next.ServeHTTP(w, r)
+		})
+	}
+	ok := func(p rt.HandlerParams) *bm.Res { return p.Res.SucJson(nil) }
+	handler := newServer(t, &rt.Router{Path: "/", Children: []rt.Router{
+		{Name: "marked", Path: "/marked", Method: http.MethodGet, Middlewares: []func(http.Handler) http.Handler{mark}, Handler: ok},
+		{Name: "plain", Path: "/plain", Method: http.MethodGet, Handler: ok},
+	}}, nil)
+
+	if w := do(handler, http.MethodGet, "/marked", "", nil); w.Header().Get("X-Mark") != "leaf" {
+		t.Errorf("Expected leaf middleware to run, got headers %v", w.Header())
+	}
+	if w := do(handler, http.MethodGet, "/plain", "", nil); w.Header().Get("X-Mark") != "" {
+		t.Errorf("Expected sibling route without middleware, got headers %v", w.Header())
+	}
+}
+
+// TestCompress 测试响应压缩与压缩级别校验
+func TestCompress(t *testing.T) {
+	big := func(p rt.HandlerParams) *bm.Res { return p.Res.SucJson(strings.Repeat("a", 4096)) }
+	router := func() *rt.Router {
+		return &rt.Router{Path: "/", Children: []rt.Router{
+			{Name: "big", Path: "/big", Method: http.MethodGet, Handler: big},
+		}}
+	}
+
+	// 子测试 1：按 Accept-Encoding 压缩响应
+	t.Run("Gzip", func(t *testing.T) {
+		handler := newServer(t, router(), map[string]interface{}{"App.Compress": true, "App.CompressLevel": gzip.BestSpeed})
+		w := do(handler, http.MethodGet, "/big", "", http.Header{"Accept-Encoding": {"gzip"}})
+		if w.Header().Get("Content-Encoding") != "gzip" {
+			t.Fatalf("Expected gzip encoding, got headers %v", w.Header())
+		}
+		reader, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatalf("gzip.NewReader: %v", err)
+		}
+		body, err := io.ReadAll(reader)
+		if err != nil || !strings.Contains(string(body), strings.Repeat("a", 4096)) {
+			t.Errorf("Unexpected body %q, %v", body, err)
+		}
+	})
+
+	// 子测试 2：超出范围的压缩级别使 Register 返回错误
+	t.Run("InvalidLevel", func(t *testing.T) {
+		viper.Reset()
+		defer viper.Reset()
+		viper.Set("App.Compress", true)
+		viper.Set("App.CompressLevel", 42)
+		if _, err := rt.Register(router()); err == nil {
+			t.Error("Expected error for invalid compress level")
+		}
+	})
+
+	// 子测试 3：直接使用 Compress 时超出范围的级别回退为默认级别
+	t.Run("FallbackLevel", func(t *testing.T) {
+		handler := rt.Compress(42, 1)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			io.WriteString(w, strings.Repeat("a", 64))
+		}))
+		w := do(handler, http.MethodGet, "/", "", http.Header{"Accept-Encoding": {"deflate"}})
+		if w.Header().Get("Content-Encoding") != "deflate" {
+			t.Errorf("Expected deflate encoding, got headers %v", w.Header())
+		}
+	})
+}
+
+// TestCacheFailure 测试未使用真实状态码时失败的响应不写入缓存
+func TestCacheFailure(t *testing.T) {
+	handler := newServer(t, &rt.Router{Path: "/", Children: []rt.Router{
+		{Name: "one", Path: "/pet/{id}", Method: http.MethodGet, Model: Pet{}, GetOne: true,
+			Bind: struct {
+				ID string `bind:"id"`
+			}{},
+			Where: [][]string{{"id = ?", "ID"}},
+			Cache: &rt.Cache{TTL: time.Minute, Store: rt.NewMemoryCache(0)}},
+	}}, nil)
+
+	w := do(handler, http.MethodGet, "/pet/1", "", nil)
+	if code, _, _ := envelope(t, w); w.Code != http.StatusOK || code < http.StatusBadRequest {
+		t.Fatalf("Expected failure envelope with HTTP 200, got %d %s", w.Code, w.Body.String())
+	}
+
+	seed(t, []Pet{{ID: 1, Name: "a"}})
+	w = do(handler, http.MethodGet, "/pet/1", "", nil)
+	if code, _, data := envelope(t, w); code >= http.StatusBadRequest || !strings.Contains(string(data), `"name":"a"`) {
+		t.Fatalf("Expected pet after failure, got %s", w.Body.String())
+	}
+	if w.Header().Get(rt.CacheHeader) != "MISS" {
+		t.Errorf("Expected failure not to be cached, got %s=%s", rt.CacheHeader, w.Header().Get(rt.CacheHeader))
+	}
+	if w = do(handler, http.MethodGet, "/pet/1", "", nil); w.Header().Get(rt.CacheHeader) != "HIT" {
+		t.Errorf("Expected success to be cached, got %s=%s", rt.CacheHeader, w.Header().Get(rt.CacheHeader))
+	}
+}
+
+// TestCachePrincipal 测试不同用户不共享缓存的响应
+func TestCachePrincipal(t *testing.T) {
+	handler := newServer(t, &rt.Router{Path: "/", Children: []rt.Router{
+		{Name: "me", Path: "/me", Method: http.MethodGet, Public: rt.Bool(false),
+			Middlewares: []func(http.Handler) http.Handler{au.Middleware(tenantAuth)},
+			Cache:       &rt.Cache{TTL: time.Minute, Store: rt.NewMemoryCache(0)},
+			Handler: func(p rt.HandlerParams) *bm.Res {
+				return p.Res.SucJson(p.Principal.ID)
+			}},
+	}}, nil)
+
+	for _, user := range []string{"u1", "u2", "u1"} {
+		w := do(handler, http.MethodGet, "/me", "", tenant(user))
+		if _, _, data := envelope(t, w); string(data) != `"`+user+`"` {
+			t.Errorf("Expected %s, got %s (%s=%s)", user, data, rt.CacheHeader, w.Header().Get(rt.CacheHeader))
+		}
+	}
+	if w := do(handler, http.MethodGet, "/me", "", tenant("u2")); w.Header().Get(rt.CacheHeader) != "HIT" {
+		t.Errorf("Expected cached response for the same user, got %s=%s", rt.CacheHeader, w.Header().Get(rt.CacheHeader))
+	}
+}
+
+// renameRequest Typed 路由的请求参数
+type renameRequest struct {
+	ID   int    `bind:"id"`
+	Name string `bind:"name"`
+}
+
+// TestRegisterChildErrors 测试组内子路由的错误由 Register 返回
+func TestRegisterChildErrors(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	rename := rt.Handle(func(ctx context.Context, req *renameRequest, tx *gorm.DB) (*Pet, error) {
+		return &Pet{ID: req.ID, Name: req.Name}, nil
+	})
+	ok := func(p rt.HandlerParams) *bm.Res { return p.Res.SucJson(nil) }
+	_, err := rt.Register(&rt.Router{Path: "/", Children: []rt.Router{{Path: "/pet", Children: []rt.Router{
+		{Name: "handler", Path: "/handler", Method: http.MethodPost, Typed: rename, Handler: ok},
+		{Name: "plain", Path: "/plain", Method: http.MethodGet, Handler: ok},
+		{Name: "bind", Path: "/bind", Method: http.MethodPost, Typed: rename, Bind: struct{ Name string }{}},
+	}}}})
+	if err == nil {
+		t.Fatal("Expected error for invalid Typed routes")
+	}
+	for _, name := range []string{"(handler)", "(bind)"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("Expected error for %s, got %v", name, err)
+		}
+	}
+}
+
+// TestAccessControl 测试 Public 的继承与关闭，以及 Public 路由上声明的角色
+func TestAccessControl(t *testing.T) {
+	tokens, err := au.NewJWT(au.JWTConfig{Secret: []byte("secret")})
+	if err != nil {
+		t.Fatalf("NewJWT: %v", err)
+	}
+	ok := func(p rt.HandlerParams) *bm.Res { return p.Res.SucJson(nil) }
+	handler := newServer(t, &rt.Router{Path: "/", Children: []rt.Router{{
+		Path:        "/api",
+		Public:      rt.Bool(true),
+		Middlewares: []func(http.Handler) http.Handler{au.Middleware(tokens)},
+		Children: []rt.Router{
+			{Name: "open", Path: "/open", Method: http.MethodGet, Handler: ok},
+			{Name: "admin", Path: "/admin", Method: http.MethodGet, Roles: []string{"admin"}, Handler: ok},
+			{Path: "/private", Public: rt.Bool(false), Children: []rt.Router{
+				{Name: "me", Path: "/me", Method: http.MethodGet, Handler: ok},
+			}},
+		},
+	}}}, nil)
+
+	bearer := func(roles ...string) http.Header {
+		pair, err := tokens.Issue(&au.Principal{ID: "1", Roles: roles})
+		if err != nil {
+			t.Fatalf("Issue: %v", err)
+		}
+		return http.Header{"Authorization": {"Bearer " + pair.AccessToken}}
+	}
+
+	cases := []struct {
+		name   string
+		target string
+		header http.Header
+		code   int
+	}{
+		{"InheritedPublic", "/api/open", nil, http.StatusOK},
+		{"PublicWithRolesAnonymous", "/api/admin", nil, http.StatusUnauthorized},
+		{"PublicWithRolesForbidden", "/api/admin", bearer("user"), http.StatusForbidden},
+		{"PublicWithRolesAllowed", "/api/admin", bearer("admin"), http.StatusOK},
+		{"PublicDisabled", "/api/private/me", nil, http.StatusUnauthorized},
+		{"PublicDisabledAuthenticated", "/api/private/me", bearer(), http.StatusOK},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w := do(handler, http.MethodGet, c.target, "", c.header)
+			if code, _, _ := envelope(t, w); code != c.code {
+				t.Errorf("Expected code %d, got %s", c.code, w.Body.String())
+			}
+		})
+	}
+}
+
+// tenantAuth 使用 X-Tenant 头部作为当前用户的租户
+var tenantAuth = au.AuthenticatorFunc(func(r *http.Request) (*au.Principal, error) {
+	tenant := r.Header.Get("X-Tenant")
+	if tenant == "" {
+		return nil, au.ErrNoCredentials
+	}
+	return &au.Principal{ID: tenant, TenantID: tenant}, nil
+})
+
+// tenant 返回指定租户的请求头部
+func tenant(id string) http.Header {
+	return http.Header{"X-Tenant": {id}}
+}
+
+// TestDataScope 测试行级数据范围对查询、写入与缓存的隔离
+func TestDataScope(t *testing.T) {
+	type petBind struct {
+		ID       int    `bind:"id"`
+		Name     string `bind:"name"`
+		TenantID string `bind:"tenant_id"`
+	}
+	byID := [][]string{{"id = ?", "ID"}}
+	handler := newServer(t, &rt.Router{Path: "/", Children: []rt.Router{{
+		Path:        "/pet",
+		DataScope:   [][]string{{"tenant_id", "tenant_id"}},
+		Middlewares: []func(http.Handler) http.Handler{au.Middleware(tenantAuth)},
+		Children: []rt.Router{
+			{Name: "list", Path: "/", Method: http.MethodGet, Model: Pet{}, GetList: true, Bind: struct{ bm.Pagination }{},
+				Cache: &rt.Cache{TTL: time.Minute, Store: rt.NewMemoryCache(0)}},
+			{Name: "one", Path: "/{id}", Method: http.MethodGet, Model: Pet{}, GetOne: true, Bind: petBind{}, Where: byID},
+			{Name: "create", Path: "/", Method: http.MethodPost, Model: Pet{}, Bind: petBind{},
+				CreateOne: map[string]string{"Name": "Name", "TenantID": "TenantID"}},
+			{Name: "import", Path: "/import", Method: http.MethodPost, Model: Pet{}, Bind: petBind{},
+				Import: map[string]string{"Name": "Name", "TenantID": "TenantID"}},
+			{Name: "update", Path: "/{id}", Method: http.MethodPut, Model: Pet{}, Bind: petBind{}, Where: byID,
+				UpdateOne: map[string]string{"Name": "Name", "TenantID": "TenantID"}},
+			{Name: "move", Path: "/{id}/move", Method: http.MethodPut, Model: Pet{}, Bind: petBind{}, Where: byID,
+				UpdateOne: map[string]string{"Name": "Name"},
+				// 模拟钩子误改主键，写入仍然只能命中当前租户的数据
+				BeforeFinish: func(p rt.HandlerParams, model interface{}) *bm.Res {
+					model.(*Pet).ID = 2
+					return nil
+				}},
+			{Name: "delete", Path: "/{id}", Method: http.MethodDelete, Model: Pet{}, Bind: petBind{}, Where: byID, DeleteOne: true},
+		},
+	}}}, nil)
+	seed(t, []Pet{{ID: 1, Name: "a", TenantID: "t1"}, {ID: 2, Name: "b", TenantID: "t2"}})
+
+	stored := func(t *testing.T, id int) Pet {
+		t.Helper()
+		var pet Pet
+		if err := db.DB.GORM.First(&pet, id).Error; err != nil {
+			t.Fatalf("First(%d): %v", id, err)
+		}
+		return pet
+	}
+	list := func(t *testing.T, id string) ([]Pet, string) {
+		t.Helper()
+		w := do(handler, http.MethodGet, "/pet/", "", tenant(id))
+		_, _, data := envelope(t, w)
+		var page struct {
+			Data []Pet `json:"data"`
+		}
+		if err := json.Unmarshal(data, &page); err != nil {
+			t.Fatalf("Unmarshal %s: %v", data, err)
+		}
+		return page.Data, w.Header().Get(rt.CacheHeader)
+	}
+	expectMissing := func(t *testing.T, w *httptest.ResponseRecorder) {
+		t.Helper()
+		if _, msg, _ := envelope(t, w); msg != "No corresponding data" {
+			t.Errorf("Expected No corresponding data, got %s", w.Body.String())
+		}
+	}
+
+	// 子测试 1：没有认证用户时拒绝访问
+	t.Run("Anonymous", func(t *testing.T) {
+		w := do(handler, http.MethodGet, "/pet/1", "", nil)
+		if code, _, _ := envelope(t, w); code != http.StatusUnauthorized {
+			t.Errorf("Expected code 401, got %s", w.Body.String())
+		}
+	})
+
+	// 子测试 2：列表只返回当前租户的数据，缓存键按租户区分
+	t.Run("ListAndCache", func(t *testing.T) {
+		for _, c := range []struct{ tenant, name, cache string }{
+			{"t1", "a", "MISS"}, {"t1", "a", "HIT"}, {"t2", "b", "MISS"}, {"t2", "b", "HIT"},
+		} {
+			pets, cache := list(t, c.tenant)
+			if len(pets) != 1 || pets[0].Name != c.name || cache != c.cache {
+				t.Errorf("Tenant %s: expected [%s] %s, got %+v %s", c.tenant, c.name, c.cache, pets, cache)
+			}
+		}
+	})
+
+	// 子测试 3：不能读取其他租户的数据
+	t.Run("GetOne", func(t *testing.T) {
+		expectMissing(t, do(handler, http.MethodGet, "/pet/2", "", tenant("t1")))
+		w := do(handler, http.MethodGet, "/pet/1", "", tenant("t1"))
+		if _, _, data := envelope(t, w); !strings.Contains(string(data), `"name":"a"`) {
+			t.Errorf("Expected own pet, got %s", w.Body.String())
+		}
+	})
+
+	// 子测试 4：更新其他租户的数据返回 No corresponding data，请求中的租户被覆盖
+	t.Run("UpdateOne", func(t *testing.T) {
+		expectMissing(t, do(handler, http.MethodPut, "/pet/2", `{"name":"x"}`, tenant("t1")))
+		if pet := stored(t, 2); pet.Name != "b" {
+			t.Errorf("Expected other tenant unchanged, got %+v", pet)
+		}
+
+		do(handler, http.MethodPut, "/pet/1", `{"name":"a2","tenant_id":"t2"}`, tenant("t1"))
+		if pet := stored(t, 1); pet.Name != "a2" || pet.TenantID != "t1" {
+			t.Errorf("Expected name a2 in t1, got %+v", pet)
+		}
+	})
+
+	// 子测试 5：写入语句本身带有数据范围
+	t.Run("UpdateWriteScoped", func(t *testing.T) {
+		expectMissing(t, do(handler, http.MethodPut, "/pet/1/move", `{"name":"x"}`, tenant("t1")))
+		if pet := stored(t, 2); pet.Name != "b" || pet.TenantID != "t2" {
+			t.Errorf("Expected other tenant unchanged, got %+v", pet)
+		}
+	})
+
+	// 子测试 6：不能删除其他租户的数据
+	t.Run("DeleteOne", func(t *testing.T) {
+		expectMissing(t, do(handler, http.MethodDelete, "/pet/2", "", tenant("t1")))
+		stored(t, 2)
+	})
+
+	// 子测试 7：创建时覆盖请求中的租户
+	t.Run("CreateOne", func(t *testing.T) {
+		w := do(handler, http.MethodPost, "/pet/", `{"name":"c","tenant_id":"t2"}`, tenant("t1"))
+		var pet Pet
+		if err := db.DB.GORM.Where("name = ?", "c").First(&pet).Error; err != nil {
+			t.Fatalf("Expected created pet, got %s: %v", w.Body.String(), err)
+		}
+		if pet.TenantID != "t1" {
+			t.Errorf("Expected tenant t1, got %+v", pet)
+		}
+	})
+
+	// 子测试 8：导入时覆盖文件中的租户
+	t.Run("Import", func(t *testing.T) {
+		w := upload(handler, "/pet/import", "pets.csv", "name,tenant_id\nd,t2\n", tenant("t1"))
+
+		var pet Pet
+		if err := db.DB.GORM.Where("name = ?", "d").First(&pet).Error; err != nil {
+			t.Fatalf("Expected imported pet, got %s: %v", w.Body.String(), err)
+		}
+		if pet.TenantID != "t1" {
+			t.Errorf("Expected tenant t1, got %+v", pet)
+		}
+	})
+}
+
+// TestAPIKeyQuota 测试访问不允许的路由不消耗 API Key 配额
+func TestAPIKeyQuota(t *testing.T) {
+	store := au.NewMemoryAPIKeyStore()
+	store.Add("secret", &au.APIKey{ID: "partner", ClientID: "c1", Routes: []string{"pet.*"}, RateLimit: 1, RateWindow: time.Hour})
+	ok := func(p rt.HandlerParams) *bm.Res { return p.Res.SucJson(nil) }
+	handler := newServer(t, &rt.Router{Path: "/", Middlewares: []func(http.Handler) http.Handler{au.Middleware(au.NewAPIKeys(store))}, Children: []rt.Router{
+		{Name: "pet", Path: "/pet", Children: []rt.Router{{Name: "list", Path: "/", Method: http.MethodGet, Handler: ok}}},
+		{Name: "owner", Path: "/owner", Children: []rt.Router{{Name: "list", Path: "/", Method: http.MethodGet, Handler: ok}}},
+	}}, nil)
+	key := http.Header{au.APIKeyHeader: {"secret"}}
+
+	for _, c := range []struct {
+		target string
+		code   int
+	}{
+		{"/owner/", http.StatusForbidden},
+		{"/owner/", http.StatusForbidden},
+		{"/pet/", http.StatusOK},
+		{"/pet/", http.StatusTooManyRequests},
+	} {
+		w := do(handler, http.MethodGet, c.target, "", key)
+		if code, _, _ := envelope(t, w); code != c.code {
+			t.Errorf("%s: expected code %d, got %s", c.target, c.code, w.Body.String())
+		}
+	}
+}
+
+// TestRateLimit 测试路由限流的继承、按路由计数、响应头以及真实的 429 状态码
+func TestRateLimit(t *testing.T) {
+	ok := func(p rt.HandlerParams) *bm.Res { return p.Res.SucJson(nil) }
+
+	// 子测试 1：子路由继承限流配置并各自计数，子组可以覆盖
+	t.Run("Route", func(t *testing.T) {
+		handler := newServer(t, &rt.Router{Path: "/", Children: []rt.Router{{
+			Name: "pet", Path: "/pet", RateLimit: &rt.RateLimit{Requests: 1, Window: time.Hour},
+			Children: []rt.Router{
+				{Name: "a", Path: "/a", Method: http.MethodGet, Handler: ok},
+				{Name: "b", Path: "/b", Method: http.MethodGet, Handler: ok},
+				{Name: "more", Path: "/more", RateLimit: &rt.RateLimit{Requests: 2, Window: time.Hour}, Children: []rt.Router{
+					{Name: "c", Path: "/c", Method: http.MethodGet, Handler: ok},
+				}},
+			},
+		}}}, nil)
+
+		for _, c := range []struct {
+			target    string
+			status    int
+			remaining string
+		}{
+			{"/pet/a", http.StatusOK, "0"},
+			{"/pet/a", http.StatusTooManyRequests, "0"},
+			{"/pet/b", http.StatusOK, "0"},
+			{"/pet/more/c", http.StatusOK, "1"},
+			{"/pet/more/c", http.StatusOK, "0"},
+			{"/pet/more/c", http.StatusTooManyRequests, "0"},
+		} {
+			w := do(handler, http.MethodGet, c.target, "", nil)
+			if w.Code != c.status {
+				t.Errorf("%s: expected status %d, got %d %s", c.target, c.status, w.Code, w.Body.String())
+			}
+			if remaining := w.Header().Get("RateLimit-Remaining"); remaining != c.remaining {
+				t.Errorf("%s: expected RateLimit-Remaining %s, got %q", c.target, c.remaining, remaining)
+			}
+			if w.Header().Get("RateLimit-Limit") == "" || w.Header().Get(rt.RateLimitResetHeader) == "" {
+				t.Errorf("%s: missing RateLimit headers %v", c.target, w.Header())
+			}
+			if (w.Code == http.StatusTooManyRequests) != (w.Header().Get("Retry-After") != "") {
+				t.Errorf("%s: unexpected Retry-After %q", c.target, w.Header().Get("Retry-After"))
+			}
+		}
+	})
+
+	// 子测试 2：App.LimitByMinuteIP 的全局限流返回真实的 429
+	t.Run("Global", func(t *testing.T) {
+		handler := newServer(t, &rt.Router{Path: "/", Children: []rt.Router{
+			{Name: "a", Path: "/a", Method: http.MethodGet, Handler: ok},
+		}}, map[string]interface{}{"App.LimitByMinuteIP": 1})
+
+		if w := do(handler, http.MethodGet, "/a", "", nil); w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		w := do(handler, http.MethodGet, "/a", "", nil)
+		if code, _, _ := envelope(t, w); w.Code != http.StatusTooManyRequests || code != http.StatusTooManyRequests {
+			t.Errorf("Expected status 429, got %d %s", w.Code, w.Body.String())
+		}
+	})
+}
+
+// TestFields 测试客户端选择返回字段
+func TestFields(t *testing.T) {
+	handler := newServer(t, &rt.Router{Path: "/", Children: []rt.Router{
+		{Name: "one", Path: "/pet/{id}", Method: http.MethodGet, Model: Pet{}, GetOne: true, Fields: []string{"id", "name"},
+			Bind: struct {
+				ID string `bind:"id"`
+			}{}, Where: [][]string{{"id = ?", "ID"}}},
+	}}, nil)
+	seed(t, []Pet{{ID: 1, Name: "a", TenantID: "t1"}})
+
+	// 子测试 1：只返回选择的字段
+	t.Run("Select", func(t *testing.T) {
+		w := do(handler, http.MethodGet, "/pet/1?fields=name", "", nil)
+		_, _, data := envelope(t, w)
+		var fields map[string]interface{}
+		if err := json.Unmarshal(data, &fields); err != nil {
+			t.Fatalf("Unmarshal %s: %v", data, err)
+		}
+		if len(fields) != 1 || fields["name"] != "a" {
+			t.Errorf("Expected only name, got %s", data)
+		}
+	})
+
+	// 子测试 2：不在 Router.Fields 中的字段被拒绝
+	t.Run("NotAllowed", func(t *testing.T) {
+		w := do(handler, http.MethodGet, "/pet/1?fields=tenant_id", "", nil)
+		if code, _, _ := envelope(t, w); code != http.StatusBadRequest {
+			t.Errorf("Expected code 400, got %s", w.Body.String())
+		}
+	})
+
+	// 子测试 3：超过 2^53 的整数不丢失精度
+	t.Run("LargeID", func(t *testing.T) {
+		seed(t, []Pet{{ID: 9007199254740993, Name: "big"}})
+		w := do(handler, http.MethodGet, "/pet/9007199254740993?fields=id", "", nil)
+		if _, _, data := envelope(t, w); string(data) != `{"id":9007199254740993}` {
+			t.Errorf("Expected exact id, got %s", data)
+		}
+	})
+}
+
+// TestGetTree 测试树形列表的组装
+func TestGetTree(t *testing.T) {
+	handler := newServer(t, &rt.Router{Path: "/", Children: []rt.Router{
+		{Name: "tree", Path: "/category", Method: http.MethodGet, Model: Category{}, GetTree: &rt.Tree{}},
+	}}, nil)
+	parent := func(id int) *int { return &id }
+	seed(t, []Category{{ID: 1, Name: "a"}, {ID: 2, Name: "a1", ParentID: parent(1)}, {ID: 3, Name: "a11", ParentID: parent(2)}, {ID: 4, Name: "b"}})
+
+	w := do(handler, http.MethodGet, "/category", "", nil)
+	_, _, data := envelope(t, w)
+	type node struct {
+		Name     string `json:"name"`
+		Children []node `json:"children"`
+	}
+	var roots []node
+	if err := json.Unmarshal(data, &roots); err != nil {
+		t.Fatalf("Unmarshal %s: %v", data, err)
+	}
+	if len(roots) != 2 || roots[0].Name != "a" || roots[1].Name != "b" {
+		t.Fatalf("Unexpected roots %s", data)
+	}
+	if len(roots[0].Children) != 1 || roots[0].Children[0].Name != "a1" ||
+		len(roots[0].Children[0].Children) != 1 || roots[0].Children[0].Children[0].Name != "a11" {
+		t.Errorf("Unexpected children %s", data)
+	}
+}
+
+// TestGetTreeLargeID 测试超过 2^53 的 ID 与父 ID 组装后不丢失精度
+func TestGetTreeLargeID(t *testing.T) {
+	handler := newServer(t, &rt.Router{Path: "/", Children: []rt.Router{
+		{Name: "tree", Path: "/category", Method: http.MethodGet, Model: Category{}, GetTree: &rt.Tree{}},
+	}}, nil)
+	parent := func(id int) *int { return &id }
+	seed(t, []Category{{ID: 9007199254740993, Name: "a"}, {ID: 9007199254740995, Name: "a1", ParentID: parent(9007199254740993)}})
+
+	w := do(handler, http.MethodGet, "/category", "", nil)
+	_, _, data := envelope(t, w)
+	expected := `[{"children":[{"id":9007199254740995,"name":"a1","parent_id":9007199254740993}],"id":9007199254740993,"name":"a","parent_id":null}]`
+	if string(data) != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+}
+
+// TestStream 测试 Server-Sent Events 路由
+func TestStream(t *testing.T) {
+	handler := newServer(t, &rt.Router{Path: "/", Children: []rt.Router{
+		{Name: "events", Path: "/events", Method: http.MethodGet, Stream: func(p rt.StreamParams) error {
+			return p.Sink.SendWithID("5", "progress", map[string]string{"last": p.Sink.LastEventID()})
+		}},
+	}}, nil)
+
+	w := do(handler, http.MethodGet, "/events", "", http.Header{bm.LastEventIDHeader: {"4"}})
+	if contentType := w.Header().Get("Content-Type"); contentType != bm.ContentTypeEventStream {
+		t.Errorf("Expected %s, got %s", bm.ContentTypeEventStream, contentType)
+	}
+	if expected := "id: 5\nevent: progress\ndata: {\"last\":\"4\"}\n\n"; !strings.Contains(w.Body.String(), expected) {
+		t.Errorf("Expected event %q, got %q", expected, w.Body.String())
+	}
+}
+
+// TestStreamConnection 测试事件流逐条刷新到客户端，并在客户端断开后停止
+func TestStreamConnection(t *testing.T) {
+	stopped := make(chan error, 1)
+	handler := newServer(t, &rt.Router{Path: "/", Children: []rt.Router{
+		{Name: "events", Path: "/events", Method: http.MethodGet, Stream: func(p rt.StreamParams) error {
+			for i := 1; ; i++ {
+				if err := p.Sink.SendWithID(strconv.Itoa(i), "tick", map[string]int{"n": i}); err != nil {
+					stopped <- err
+					return err
+				}
+				select {
+				case <-p.Sink.Done():
+					stopped <- nil
+					return nil
+				case <-time.After(10 * time.Millisecond):
+				}
+			}
+		}},
+	}}, nil)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/events", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	defer resp.Body.Close()
+	if contentType := resp.Header.Get("Content-Type"); contentType != bm.ContentTypeEventStream {
+		t.Errorf("Expected %s, got %s", bm.ContentTypeEventStream, contentType)
+	}
+
+	// 处理函数仍在运行时即可读到事件，说明每条事件都已刷新。
+	reader := bufio.NewReader(resp.Body)
+	for i := 1; i <= 2; i++ {
+		var event strings.Builder
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("ReadString: %v", err)
+			}
+			if line == "\n" {
+				break
+			}
+			if !strings.HasPrefix(line, ":") {
+				event.WriteString(line)
+			}
+		}
+		if expected := fmt.Sprintf("id: %d\nevent: tick\ndata: {\"n\":%d}\n", i, i); event.String() != expected {
+			t.Errorf("Expected event %q, got %q", expected, event.String())
+		}
+	}
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the stream to stop after the client disconnected")
+	}
+}
+
+// TestETag 测试条件 GET 与写操作的 If-Match 校验
+func TestETag(t *testing.T) {
+	type petBind struct {
+		ID   string `bind:"id"`
+		Name string `bind:"name"`
+	}
+	byID := [][]string{{"id = ?", "ID"}}
+	handler := newServer(t, &rt.Router{Path: "/", Children: []rt.Router{{Path: "/pet", Children: []rt.Router{
+		{Name: "one", Path: "/{id}", Method: http.MethodGet, Model: Pet{}, GetOne: true, ETag: true, Bind: petBind{}, Where: byID},
+		{Name: "update", Path: "/{id}", Method: http.MethodPut, Model: Pet{}, ETag: true, Bind: petBind{}, Where: byID,
+			UpdateOne: map[string]string{"Name": "Name"}},
+	}}}}, nil)
+	seed(t, []Pet{{ID: 1, Name: "a"}})
+
+	w := do(handler, http.MethodGet, "/pet/1", "", nil)
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatalf("Expected ETag, got headers %v", w.Header())
+	}
+	if w = do(handler, http.MethodGet, "/pet/1", "", http.Header{"If-None-Match": {etag}}); w.Code != http.StatusNotModified {
+		t.Errorf("Expected status 304, got %d", w.Code)
+	}
+
+	for _, c := range []struct {
+		name   string
+		header http.Header
+		code   int
+	}{
+		{"MissingIfMatch", nil, http.StatusPreconditionRequired},
+		{"StaleIfMatch", http.Header{"If-Match": {`"stale"`}}, http.StatusPreconditionFailed},
+		{"IfMatch", http.Header{"If-Match": {etag}}, http.StatusOK},
+		{"ReusedIfMatch", http.Header{"If-Match": {etag}}, http.StatusPreconditionFailed},
+	} {
+		w := do(handler, http.MethodPut, "/pet/1", `{"name":"b"}`, c.header)
+		if code, _, _ := envelope(t, w); code != c.code {
+			t.Errorf("%s: expected code %d, got %s", c.name, c.code, w.Body.String())
+		}
+	}
+
+	// 不同编码的响应使用不同的 ETag，If-Match 仍可使用任一编码的 ETag
+	jsonETag := do(handler, http.MethodGet, "/pet/1", "", nil).Header().Get("ETag")
+	xml := http.Header{"Accept": {bm.ContentTypeXML}}
+	xmlETag := do(handler, http.MethodGet, "/pet/1", "", xml).Header().Get("ETag")
+	if xmlETag == "" || xmlETag == jsonETag {
+		t.Fatalf("Expected distinct XML ETag, got %s and %s", jsonETag, xmlETag)
+	}
+	if w := do(handler, http.MethodGet, "/pet/1", "", http.Header{"Accept": {bm.ContentTypeXML}, "If-None-Match": {jsonETag}}); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for JSON ETag with XML Accept, got %d", w.Code)
+	}
+	if w := do(handler, http.MethodGet, "/pet/1", "", http.Header{"Accept": {bm.ContentTypeXML}, "If-None-Match": {xmlETag}}); w.Code != http.StatusNotModified {
+		t.Errorf("Expected status 304 for XML ETag, got %d", w.Code)
+	}
+	w = do(handler, http.MethodPut, "/pet/1", `{"name":"c"}`, http.Header{"If-Match": {xmlETag}})
+	if code, _, _ := envelope(t, w); code != http.StatusOK {
+		t.Errorf("Expected If-Match with XML ETag to succeed, got %s", w.Body.String())
+	}
+}
+
+// Note 测试 Last-Modified 使用的模型
+type Note struct {
+	ID        int       `gorm:"primarykey" json:"id"`
+	Name      string    `json:"name"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TestETagList 测试列表只使用 ETag，删除数据后条件请求不返回 304
+func TestETagList(t *testing.T) {
+	handler := newServer(t, &rt.Router{Path: "/", Children: []rt.Router{
+		{Name: "list", Path: "/note", Method: http.MethodGet, Model: Note{}, GetList: true, ETag: true, Bind: struct{ bm.Pagination }{}},
+		{Name: "one", Path: "/note/{id}", Method: http.MethodGet, Model: Note{}, GetOne: true, ETag: true,
+			Bind: struct {
+				ID string `bind:"id"`
+			}{}, Where: [][]string{{"id = ?", "ID"}}},
+	}}, nil)
+	seed(t, []Note{{ID: 1, Name: "a"}, {ID: 2, Name: "b"}})
+
+	if w := do(handler, http.MethodGet, "/note/1", "", nil); w.Header().Get("Last-Modified") == "" {
+		t.Errorf("Expected Last-Modified for GetOne, got headers %v", w.Header())
+	}
+
+	w := do(handler, http.MethodGet, "/note", "", nil)
+	etag := w.Header().Get("ETag")
+	if etag == "" || w.Header().Get("Last-Modified") != "" {
+		t.Fatalf("Expected only ETag for the list, got headers %v", w.Header())
+	}
+	since := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if w := do(handler, http.MethodGet, "/note", "", http.Header{"If-Modified-Since": {since}}); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for If-Modified-Since, got %d", w.Code)
+	}
+
+	db.DB.GORM.Delete(&Note{}, 2)
+	if w := do(handler, http.MethodGet, "/note", "", http.Header{"If-None-Match": {etag}}); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 after delete, got %d", w.Code)
+	}
+}
+
+// TestTyped 测试泛型处理函数的绑定、返回值与错误回滚
+func TestTyped(t *testing.T) {
+	handler := newServer(t, &rt.Router{Path: "/", Children: []rt.Router{
+		{Name: "rename", Path: "/pet/{id}/rename", Method: http.MethodPost,
+			Typed: rt.Handle(func(ctx context.Context, req *renameRequest, tx *gorm.DB) (*Pet, error) {
+				var pet Pet
+				if err := tx.First(&pet, req.ID).Error; err != nil {
+					return nil, bm.ErrNotFound
+				}
+				pet.Name = req.Name
+				if err := tx.Save(&pet).Error; err != nil {
+					return nil, err
+				}
+				if req.Name == "rollback" {
+					return nil, bm.ErrBadRequest
+				}
+				return &pet, nil
+			})},
+	}}, nil)
+	// Typed 路由没有 Model，不会自动迁移
+	if err := db.DB.GORM.AutoMigrate(&Pet{}); err != nil {
+		t.Fatalf("AutoMigrate: %v", err)
+	}
+	seed(t, []Pet{{ID: 1, Name: "a"}})
+
+	w := do(handler, http.MethodPost, "/pet/1/rename", `{"name":"b"}`, nil)
+	if _, _, data := envelope(t, w); !strings.Contains(string(data), `"name":"b"`) {
+		t.Errorf("Expected renamed pet, got %s", w.Body.String())
+	}
+	w = do(handler, http.MethodPost, "/pet/2/rename", `{"name":"b"}`, nil)
+	if code, _, _ := envelope(t, w); code != http.StatusNotFound {
+		t.Errorf("Expected code 404, got %s", w.Body.String())
+	}
+
+	w = do(handler, http.MethodPost, "/pet/1/rename", `{"name":"rollback"}`, nil)
+	if code, _, _ := envelope(t, w); code != http.StatusBadRequest {
+		t.Errorf("Expected code 400, got %s", w.Body.String())
+	}
+	var pet Pet
+	if db.DB.GORM.First(&pet, 1); pet.Name != "b" {
+		t.Errorf("Expected rollback, got %+v", pet)
+	}
+}
+
+// createPetRouter 返回带有前后钩子的创建路由
+func createPetRouter() *rt.Router {
+	return &rt.Router{Path: "/", Children: []rt.Router{
+		{Name: "create", Path: "/pet", Method: http.MethodPost, Model: Pet{},
+			Bind: struct {
+				Name string `bind:"name" validate:"required"`
+			}{},
+			CreateOne: map[string]string{"Name": "Name"},
+			BeforeFinish: func(p rt.HandlerParams, model interface{}) *bm.Res {
+				pet := model.(*Pet)
+				if pet.Name == "bad" {
+					return p.Res.FailFront("名称不合法")
+				}
+				pet.TenantID = "hooked"
+				return nil
+			},
+			AfterFinish: func(p rt.HandlerParams, result interface{}) (interface{}, *bm.Res) {
+				if result.(*Pet).Name == "rollback" {
+					return nil, p.Res.Fail(bm.ErrBadRequest)
+				}
+				return map[string]interface{}{"created": result}, nil
+			}},
+	}}
+}
+
+// TestHooks 测试 Finisher 前后钩子对写入数据与返回结果的处理
+func TestHooks(t *testing.T) {
+	handler := newServer(t, createPetRouter(), nil)
+
+	w := do(handler, http.MethodPost, "/pet", `{"name":"bad"}`, nil)
+	if code, _, _ := envelope(t, w); code != http.StatusBadRequest {
+		t.Errorf("Expected BeforeFinish to abort, got %s", w.Body.String())
+	}
+
+	w = do(handler, http.MethodPost, "/pet", `{"name":"a"}`, nil)
+	if _, _, data := envelope(t, w); !strings.Contains(string(data), `"created":{`) {
+		t.Errorf("Expected AfterFinish result, got %s", w.Body.String())
+	}
+
+	var pets []Pet
+	db.DB.GORM.Find(&pets)
+	if len(pets) != 1 || pets[0].Name != "a" || pets[0].TenantID != "hooked" {
+		t.Errorf("Unexpected pets %+v", pets)
+	}
+}
+
+// TestFinisherRollback 测试 AfterFinish 失败时回滚 Finisher 的写入
+func TestFinisherRollback(t *testing.T) {
+	handler := newServer(t, createPetRouter(), nil)
+
+	w := do(handler, http.MethodPost, "/pet", `{"name":"rollback"}`, nil)
+	if code, _, _ := envelope(t, w); code != http.StatusBadRequest {
+		t.Errorf("Expected AfterFinish to fail, got %s", w.Body.String())
+	}
+	var count int64
+	if db.DB.GORM.Model(&Pet{}).Count(&count); count != 0 {
+		t.Errorf("Expected create to be rolled back, got %d rows", count)
+	}
+}
+
+// txRecorder 记录开启事务时的选项
+type txRecorder struct {
+	*sql.DB
+	options []*sql.TxOptions
+}
+
+// BeginTx 实现 gorm.TxBeginner 接口，sqlite 不支持设置隔离级别，记录后使用默认级别开启事务。
+func (p *txRecorder) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	p.options = append(p.options, opts)
+	return p.DB.BeginTx(ctx, nil)
+}
+
+// GetDBConn 实现 gorm.GetDBConnector 接口，使测试结束时仍能关闭数据库。
+func (p *txRecorder) GetDBConn() (*sql.DB, error) {
+	return p.DB, nil
+}
+
+// TestTxOptions 测试事务隔离级别与 UpdateOne/DeleteOne 查询的行锁
+func TestTxOptions(t *testing.T) {
+	byID := [][]string{{"id = ?", "ID"}}
+	bind := struct {
+		ID   int    `bind:"id"`
+		Name string `bind:"name"`
+	}{}
+	handler := newServer(t, &rt.Router{Path: "/", Children: []rt.Router{
+		{Name: "one", Path: "/pet/{id}", Method: http.MethodGet, Model: Pet{}, GetOne: true, Bind: bind, Where: byID},
+		{Name: "update", Path: "/pet/{id}", Method: http.MethodPut, Model: Pet{}, Bind: bind, Where: byID,
+			UpdateOne: map[string]string{"Name": "Name"}, Isolation: sql.LevelSerializable},
+		{Name: "delete", Path: "/pet/{id}", Method: http.MethodDelete, Model: Pet{}, Bind: bind, Where: byID, DeleteOne: true},
+	}}, map[string]interface{}{"App.TxIsolation": "read committed"})
+	seed(t, []Pet{{ID: 1, Name: "a"}, {ID: 2, Name: "b"}})
+
+	sqlDB, err := db.DB.GORM.DB()
+	if err != nil {
+		t.Fatalf("DB: %v", err)
+	}
+	pool := &txRecorder{DB: sqlDB}
+	db.DB.GORM.ConnPool = pool
+	db.DB.GORM.Statement.ConnPool = pool
+
+	// sqlite 不输出 FOR UPDATE，在查询前记录语句中的行锁子句
+	var locks []string
+	db.DB.GORM.Callback().Query().Before("gorm:query").Register("test:locking", func(tx *gorm.DB) {
+		lock := ""
+		if c, ok := tx.Statement.Clauses["FOR"]; ok {
+			statement := &gorm.Statement{DB: tx}
+			c.Build(statement)
+			lock = statement.SQL.String()
+		}
+		locks = append(locks, lock)
+	})
+
+	for _, c := range []struct {
+		method    string
+		body      string
+		isolation sql.IsolationLevel
+	}{
+		{http.MethodPut, `{"name":"c"}`, sql.LevelSerializable},
+		{http.MethodDelete, "", sql.LevelReadCommitted},
+	} {
+		pool.options, locks = nil, nil
+		w := do(handler, c.method, "/pet/1", c.body, nil)
+		if code, _, _ := envelope(t, w); code >= http.StatusBadRequest {
+			t.Fatalf("%s: unexpected failure %s", c.method, w.Body.String())
+		}
+		if len(pool.options) != 1 || pool.options[0] == nil || pool.options[0].Isolation != c.isolation {
+			t.Errorf("%s: expected isolation %s, got %+v", c.method, c.isolation, pool.options)
+		}
+		if len(locks) != 1 || locks[0] != "FOR UPDATE" {
+			t.Errorf("%s: expected FOR UPDATE lookup, got %q", c.method, locks)
+		}
+	}
+
+	// 读取不加锁
+	locks = nil
+	do(handler, http.MethodGet, "/pet/2", "", nil)
+	if len(locks) != 1 || locks[0] != "" {
+		t.Errorf("Expected GetOne without lock, got %q", locks)
+	}
+}
+
+// TestQueryTimeout 测试数据库查询超时返回 503
+func TestQueryTimeout(t *testing.T) {
+	slow := func(ds.FieldReader) func(*gorm.DB) *gorm.DB {
+		return func(tx *gorm.DB) *gorm.DB {
+			time.Sleep(20 * time.Millisecond)
+			return tx
+		}
+	}
+	handler := newServer(t, &rt.Router{Path: "/", Children: []rt.Router{
+		{Name: "list", Path: "/pet", Method: http.MethodGet, Model: Pet{}, GetList: true, QueryTimeout: time.Millisecond, Scopes: []rt.Scope{slow}},
+	}}, nil)
+
+	w := do(handler, http.MethodGet, "/pet", "", nil)
+	if code, _, _ := envelope(t, w); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected code 503, got %s", w.Body.String())
+	}
+}
+
+// TestLimits 测试请求体大小限制与请求超时的继承
+func TestLimits(t *testing.T) {
+	var deadline bool
+	handler := newServer(t, &rt.Router{Path: "/", Children: []rt.Router{{
+		Path: "/pet", MaxBodyBytes: 16, Timeout: time.Minute,
+		Children: []rt.Router{
+			{Name: "create", Path: "/", Method: http.MethodPost, Model: Pet{},
+				Bind: struct {
+					Name string `bind:"name"`
+				}{},
+				CreateOne: map[string]string{"Name": "Name"}},
+			{Name: "big", Path: "/big", Method: http.MethodPost, MaxBodyBytes: -1, Handler: func(p rt.HandlerParams) *bm.Res {
+				_, deadline = p.R.Context().Deadline()
+				if _, err := io.ReadAll(p.R.Body); err != nil {
+					return p.Res.Fail(err)
+				}
+				return p.Res.SucJson(nil)
+			}},
+		},
+	}}}, nil)
+	body := `{"name":"` + strings.Repeat("a", 32) + `"}`
+
+	w := do(handler, http.MethodPost, "/pet/", body, nil)
+	if code, _, _ := envelope(t, w); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected code 413, got %s", w.Body.String())
+	}
+	w = do(handler, http.MethodPost, "/pet/big", body, nil)
+	if code, _, _ := envelope(t, w); code != http.StatusOK || !deadline {
+		t.Errorf("Expected unlimited body with inherited timeout, got %s deadline=%v", w.Body.String(), deadline)
+	}
+}
+
+// TestImport 测试导入的逐行校验与结果报告，任一行校验失败时不写入任何数据
+func TestImport(t *testing.T) {
+	handler := newServer(t, &rt.Router{Path: "/", Middlewares: []func(http.Handler) http.Handler{au.Middleware(tenantAuth)}, Children: []rt.Router{
+		{Name: "import", Path: "/pet/import", Method: http.MethodPost, Model: Pet{},
+			Bind: struct {
+				Name     string `bind:"name" validate:"required,max=5"`
+				TenantID string `bind:"tenant_id" auth:"tenant_id"`
+			}{},
+			Import: map[string]string{"Name": "Name", "TenantID": "TenantID"}},
+	}}, nil)
+	count := func() int64 {
+		var count int64
+		db.DB.GORM.Model(&Pet{}).Count(&count)
+		return count
+	}
+	report := func(t *testing.T, w *httptest.ResponseRecorder) bm.ImportReport {
+		t.Helper()
+		_, _, data := envelope(t, w)
+		var report bm.ImportReport
+		if err := json.Unmarshal(data, &report); err != nil {
+			t.Fatalf("Unmarshal %s: %v", data, err)
+		}
+		return report
+	}
+
+	// 子测试 1：任一行校验失败时不写入任何数据
+	t.Run("Invalid", func(t *testing.T) {
+		w := upload(handler, "/pet/import", "pets.csv", "name\na\ntoolong\nb\n", tenant("t1"))
+		if r := report(t, w); r.Total != 3 || r.Success != 0 || len(r.Errors) != 1 || r.Errors[0].Row != 3 || r.Errors[0].Column != "name" {
+			t.Errorf("Unexpected report %s", w.Body.String())
+		}
+		if n := count(); n != 0 {
+			t.Errorf("Expected nothing imported, got %d rows", n)
+		}
+	})
+
+	// 子测试 2：未在 Router.Import 中声明的列被拒绝
+	t.Run("UndeclaredColumn", func(t *testing.T) {
+		w := upload(handler, "/pet/import", "pets.csv", "id,name\n100,a\n", tenant("t1"))
+		if code, msg, _ := envelope(t, w); code != http.StatusBadRequest || !strings.Contains(msg, "'id'") {
+			t.Errorf("Expected code 400 for column id, got %s", w.Body.String())
+		}
+		if n := count(); n != 0 {
+			t.Errorf("Expected nothing imported, got %d rows", n)
+		}
+	})
+
+	// 子测试 3：auth 字段由当前用户填充，覆盖文件中的值
+	t.Run("Success", func(t *testing.T) {
+		w := upload(handler, "/pet/import", "pets.csv", "name,tenant_id\na,evil\nb,\n", tenant("t1"))
+		if !strings.Contains(w.Body.String(), `"errors":[]`) {
+			t.Errorf("Expected empty errors, got %s", w.Body.String())
+		}
+		if r := report(t, w); r.Total != 2 || r.Success != 2 {
+			t.Errorf("Unexpected report %s", w.Body.String())
+		}
+		var pets []Pet
+		db.DB.GORM.Order("name").Find(&pets)
+		if len(pets) != 2 || pets[0].TenantID != "t1" || pets[1].TenantID != "t1" {
+			t.Errorf("Expected pets of tenant t1, got %+v", pets)
+		}
+	})
+
+	// 子测试 4：导入路由必须设置 Bind
+	t.Run("NoBind", func(t *testing.T) {
+		viper.Reset()
+		_, err := rt.Register(&rt.Router{Path: "/", Children: []rt.Router{
+			{Name: "import", Path: "/pet/import", Method: http.MethodPost, Model: Pet{}, Import: map[string]string{"Name": "Name"}},
+		}})
+		if err == nil || !strings.Contains(err.Error(), "Router.Import requires Router.Bind") {
+			t.Errorf("Expected Router.Bind error, got %v", err)
+		}
+	})
+}
+
+// TestWebSocket 测试 WebSocket 路由的绑定与收发
+func TestWebSocket(t *testing.T) {
+	handler := newServer(t, &rt.Router{Path: "/", Children: []rt.Router{
+		{Name: "echo", Path: "/echo", Method: http.MethodGet, Bind: struct {
+			Prefix string `bind:"prefix"`
+			Token  string `header:"x-token"`
+		}{},
+			WebSocket: func(p rt.WebSocketParams) error {
+				prefix, _ := p.BindReader.SafeString("Prefix")
+				token, _ := p.BindReader.SafeString("Token")
+				var message map[string]string
+				if err := p.Conn.ReadJSON(&message); err != nil {
+					return err
+				}
+				return p.Conn.WriteJSON(map[string]string{"echo": prefix + message["text"], "token": token})
+			}},
+	}}, nil)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/echo?prefix=re:", http.Header{"X-Token": {"secret"}})
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.WriteJSON(map[string]string{"text": "hi"}); err != nil {
+		t.Fatalf("WriteJSON: %v", err)
+	}
+	var reply map[string]string
+	if err := conn.ReadJSON(&reply); err != nil || reply["echo"] != "re:hi" || reply["token"] != "secret" {
+		t.Errorf("Unexpected reply %v, %v", reply, err)
+	}
+}
+
+// TestAuthBind 测试 Bind 中的 auth 字段由当前用户填充且不接受请求参数
+func TestAuthBind(t *testing.T) {
+	handler := newServer(t, &rt.Router{Path: "/", Middlewares: []func(http.Handler) http.Handler{au.Middleware(tenantAuth)}, Children: []rt.Router{
+		{Name: "me", Path: "/me", Method: http.MethodPost, Bind: struct {
+			UserID   string `bind:"user_id" auth:"user_id"`
+			TenantID string `auth:"tenant_id"`
+		}{}, Handler: func(p rt.HandlerParams) *bm.Res {
+			userID, _ := p.BindReader.SafeString("UserID")
+			tenantID, _ := p.BindReader.SafeString("TenantID")
+			return p.Res.SucJson(userID + "/" + tenantID)
+		}},
+	}}, nil)
+
+	w := do(handler, http.MethodPost, "/me", `{"user_id":"evil"}`, tenant("t1"))
+	if _, _, data := envelope(t, w); string(data) != `"t1/t1"` {
+		t.Errorf("Expected principal values, got %s", w.Body.String())
+	}
+	w = do(handler, http.MethodPost, "/me", `{"user_id":"evil"}`, nil)
+	if code, _, _ := envelope(t, w); code != http.StatusUnauthorized {
+		t.Errorf("Expected code 401, got %s", w.Body.String())
+	}
+}
+
+// TestExportXLSX 测试 Excel 导出
+func TestExportXLSX(t *testing.T) {
+	handler := newServer(t, &rt.Router{Path: "/", Children: []rt.Router{
+		{Name: "export", Path: "/pet", Method: http.MethodGet, Model: Pet{}, GetList: true, Export: true, Order: []string{"id"}},
+	}}, nil)
+	seed(t, []Pet{{ID: 1, Name: "a"}, {ID: 2, Name: "b"}})
+
+	w := do(handler, http.MethodGet, "/pet?format=xlsx&fields=name", "", nil)
+	if contentType := w.Header().Get("Content-Type"); contentType != bm.ContentTypeXLSX {
+		t.Fatalf("Expected %s, got %s %s", bm.ContentTypeXLSX, contentType, w.Body.String())
+	}
+	file, err := excelize.OpenReader(w.Body)
+	if err != nil {
+		t.Fatalf("OpenReader: %v", err)
+	}
+	defer file.Close()
+	rows, err := file.GetRows(file.GetSheetName(0))
+	if err != nil {
+		t.Fatalf("GetRows: %v", err)
+	}
+	if fmt.Sprint(rows) != "[[name] [a] [b]]" {
+		t.Errorf("Unexpected rows %v", rows)
+	}
+}
+
+// TestExportCSV 测试 CSV 导出的表头、字段选择与转义
+func TestExportCSV(t *testing.T) {
+	handler := newServer(t, &rt.Router{Path: "/", Children: []rt.Router{
+		{Name: "export", Path: "/pet", Method: http.MethodGet, Model: Pet{}, GetList: true, Export: true, Order: []string{"id"}},
+	}}, nil)
+	seed(t, []Pet{{ID: 1, Name: "a,b", TenantID: "t1"}, {ID: 2, Name: "line1\nline2", TenantID: "t2"}})
+
+	export := func(t *testing.T, target string, header http.Header) string {
+		t.Helper()
+		w := do(handler, http.MethodGet, target, "", header)
+		if contentType := w.Header().Get("Content-Type"); contentType != bm.ContentTypeCSV {
+			t.Fatalf("Expected %s, got %s %s", bm.ContentTypeCSV, contentType, w.Body.String())
+		}
+		return strings.TrimPrefix(w.Body.String(), "\ufeff")
+	}
+
+	// 子测试 1：全部列，逗号与换行按 CSV 规则加引号
+	t.Run("AllFields", func(t *testing.T) {
+		body := export(t, "/pet?format=csv", nil)
+		expected := "id,name,tenant_id\n1,\"a,b\",t1\n2,\"line1\nline2\",t2\n"
+		if strings.ReplaceAll(body, "\r\n", "\n") != expected {
+			t.Errorf("Expected %q, got %q", expected, body)
+		}
+	})
+
+	// 子测试 2：fields 只导出所选列，Accept 同样可以选择 CSV
+	t.Run("SelectedFields", func(t *testing.T) {
+		body := export(t, "/pet?fields=name", http.Header{"Accept": {"text/csv"}})
+		records, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+		if err != nil {
+			t.Fatalf("ReadAll: %v", err)
+		}
+		if fmt.Sprintf("%q", records) != `[["name"] ["a,b"] ["line1\nline2"]]` {
+			t.Errorf("Unexpected records %q", records)
+		}
+	})
+}
+
+// TestErrorNegotiation 测试 SSE 与导出路由的失败响应不因 Accept 返回 406
+func TestErrorNegotiation(t *testing.T) {
+	handler := newServer(t, &rt.Router{Path: "/", Children: []rt.Router{
+		{Name: "events", Path: "/events", Method: http.MethodGet, Public: rt.Bool(false),
+			Middlewares: []func(http.Handler) http.Handler{au.Middleware(tenantAuth)},
+			Stream:      func(p rt.StreamParams) error { return nil }},
+		{Name: "export", Path: "/pet", Method: http.MethodGet, Model: Pet{}, GetList: true, Export: true,
+			Bind: struct {
+				Name string `bind:"name" validate:"required"`
+			}{}},
+	}}, map[string]interface{}{"Res.RealStatus": true})
+
+	for _, c := range []struct {
+		target string
+		accept string
+		status int
+	}{
+		{"/events", bm.ContentTypeEventStream, http.StatusUnauthorized},
+		{"/pet", "text/csv", http.StatusBadRequest},
+	} {
+		w := do(handler, http.MethodGet, c.target, "", http.Header{"Accept": {c.accept}})
+		if w.Code != c.status || w.Header().Get("Content-Type") != bm.ContentTypeJSON {
+			t.Errorf("%s: expected JSON %d, got %d %s %s", c.target, c.status, w.Code, w.Header().Get("Content-Type"), w.Body.String())
+		}
+	}
+}
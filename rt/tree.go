@@ -0,0 +1,165 @@
+// Package rt 提供了自关联表的树形列表组装功能。
+package rt
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/QingShan-Xu/web/ds"
+)
+
+// Tree 定义了树形列表的组装方式。
+type Tree struct {
+	IDField     string // 模型 ID 字段名，默认 "ID"
+	ParentField string // 模型父级 ID 字段名，默认 "ParentID"
+	ChildrenKey string // 子节点列表的 json 键，默认 "children"
+	MaxDepth    int    // 最大深度，0 表示不限制
+	RootID      string // 根节点 ID 取自 Bind 中的字段，为空或值为 nil 时以没有父级的节点为根
+}
+
+// treeNode 组装过程中的节点。
+type treeNode struct {
+	id     string
+	parent string
+	data   map[string]interface{}
+}
+
+// withDefaults 返回填充默认值后的配置。
+func (t Tree) withDefaults() Tree {
+	if t.IDField == "" {
+		t.IDField = "ID"
+	}
+	if t.ParentField == "" {
+		t.ParentField = "ParentID"
+	}
+	if t.ChildrenKey == "" {
+		t.ChildrenKey = "children"
+	}
+	return t
+}
+
+// buildTree 将模型切片组装为嵌套的树。
+// items: 模型切片的指针。
+// bindReader: 绑定数据的结构体读取器，用于读取根节点 ID。
+// 返回根节点列表或错误信息（例如检测到循环引用）。
+func (t Tree) buildTree(items interface{}, bindReader ds.FieldReader) ([]map[string]interface{}, error) {
+	t = t.withDefaults()
+
+	body, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	var data []map[string]interface{}
+	if err := unmarshalNumber(body, &data); err != nil {
+		return nil, err
+	}
+
+	slice := reflect.Indirect(reflect.ValueOf(items))
+	nodes := make([]treeNode, slice.Len())
+	ids := make(map[string]bool, slice.Len())
+	for i := 0; i < slice.Len(); i++ {
+		reader, err := ds.NewStructReader(slice.Index(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		id, err := treeKey(reader, t.IDField)
+		if err != nil {
+			return nil, err
+		}
+		parent, err := treeKey(reader, t.ParentField)
+		if err != nil {
+			return nil, err
+		}
+		nodes[i] = treeNode{id: id, parent: parent, data: data[i]}
+		ids[id] = true
+	}
+
+	rootKey, hasRoot := "", false
+	if t.RootID != "" && bindReader != nil {
+		if field, err := bindReader.GetField(t.RootID); err == nil && !IsNil(field.Interface()) {
+			rootKey, hasRoot = fmt.Sprint(reflect.Indirect(reflect.ValueOf(field.Interface())).Interface()), true
+		}
+	}
+
+	children := map[string][]int{}
+	var roots []int
+	for i, node := range nodes {
+		isRoot := node.parent == rootKey
+		if !hasRoot {
+			isRoot = node.parent == "" || !ids[node.parent]
+		}
+		if isRoot {
+			roots = append(roots, i)
+		} else {
+			children[node.parent] = append(children[node.parent], i)
+		}
+	}
+
+	visited := make(map[string]bool, len(nodes))
+	var attach func(index, depth int, path map[string]bool) error
+	attach = func(index, depth int, path map[string]bool) error {
+		node := nodes[index]
+		if path[node.id] {
+			return fmt.Errorf("cycle detected in tree at node '%s'", node.id)
+		}
+		visited[node.id] = true
+
+		path[node.id] = true
+		defer delete(path, node.id)
+
+		// 超出最大深度的节点仍需遍历以检测循环，但不再挂载到树上。
+		var childData []map[string]interface{}
+		for _, childIndex := range children[node.id] {
+			if err := attach(childIndex, depth+1, path); err != nil {
+				return err
+			}
+			childData = append(childData, nodes[childIndex].data)
+		}
+		if len(childData) > 0 && (t.MaxDepth == 0 || depth < t.MaxDepth) {
+			node.data[t.ChildrenKey] = childData
+		}
+		return nil
+	}
+
+	result := make([]map[string]interface{}, 0, len(roots))
+	for _, index := range roots {
+		// 指定根节点时，根节点出现在子孙中同样视为循环。
+		path := map[string]bool{}
+		if hasRoot {
+			path[rootKey] = true
+		}
+		if err := attach(index, 1, path); err != nil {
+			return nil, err
+		}
+		result = append(result, nodes[index].data)
+	}
+
+	// 没有指定根节点时，所有节点都应可达，不可达的节点必然处于循环中。
+	if !hasRoot {
+		for _, node := range nodes {
+			if !visited[node.id] {
+				return nil, fmt.Errorf("cycle detected in tree at node '%s'", node.id)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// treeKey 读取节点的 ID 或父级 ID，nil 与零值视为空。
+func treeKey(reader ds.FieldReader, fieldName string) (string, error) {
+	field, err := reader.GetField(fieldName)
+	if err != nil {
+		return "", fmt.Errorf("Router.GetTree: model lacks field '%s'", fieldName)
+	}
+	value := field.Interface()
+	if IsNil(value) {
+		return "", nil
+	}
+	v := reflect.Indirect(reflect.ValueOf(value))
+	if v.IsZero() {
+		return "", nil
+	}
+	return fmt.Sprint(v.Interface()), nil
+}
@@ -0,0 +1,60 @@
+// Package rt 提供了事务与查询超时的配置。
+package rt
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+var (
+	defaultIsolation    sql.IsolationLevel // 全局默认的事务隔离级别，由 App.TxIsolation 配置
+	defaultQueryTimeout time.Duration      // 全局默认的查询超时，由 App.QueryTimeout 配置
+)
+
+// lockForUpdate UpdateOne/DeleteOne 查询时使用的行锁。
+var lockForUpdate = clause.Locking{Strength: "UPDATE"}
+
+// ParseIsolation 解析事务隔离级别名称，例如 "read committed"、"repeatable_read"、"serializable"，为空时返回数据库默认级别。
+// name: 隔离级别名称，不区分大小写，空格、下划线与连字符等价。
+func ParseIsolation(name string) (sql.IsolationLevel, error) {
+	normalized := strings.NewReplacer("_", " ", "-", " ").Replace(strings.ToLower(strings.TrimSpace(name)))
+	if normalized == "" || normalized == "default" {
+		return sql.LevelDefault, nil
+	}
+	for level := sql.LevelDefault; level <= sql.LevelLinearizable; level++ {
+		if strings.ToLower(level.String()) == normalized {
+			return level, nil
+		}
+	}
+	return sql.LevelDefault, fmt.Errorf("unknown transaction isolation level '%s'", name)
+}
+
+// queryContext 返回数据库查询使用的上下文，未配置超时或为流式输出时为请求上下文。
+func (h *handler) queryContext(r *http.Request) (context.Context, context.CancelFunc) {
+	timeout := h.Router.QueryTimeout
+	if timeout <= 0 {
+		timeout = defaultQueryTimeout
+	}
+	if timeout <= 0 || h.isStreaming(r) {
+		return context.WithCancel(r.Context())
+	}
+	return context.WithTimeout(r.Context(), timeout)
+}
+
+// txOptions 返回路由的事务选项，未配置隔离级别时返回 nil 以兼容不支持设置隔离级别的数据库。
+func (h *handler) txOptions() []*sql.TxOptions {
+	level := h.Router.Isolation
+	if level == sql.LevelDefault {
+		level = defaultIsolation
+	}
+	if level == sql.LevelDefault {
+		return nil
+	}
+	return []*sql.TxOptions{{Isolation: level}}
+}
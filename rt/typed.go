@@ -0,0 +1,80 @@
+// Package rt 提供了泛型处理函数。
+package rt
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/QingShan-Xu/web/bm"
+	"gorm.io/gorm"
+)
+
+// TypedHandler 是由 Handle 创建的泛型处理函数。
+type TypedHandler interface {
+	// bind 返回请求参数绑定结构体的零值。
+	bind() interface{}
+	// serve 调用处理函数，bindData 为绑定并校验后的结构体指针。
+	serve(ctx context.Context, bindData interface{}, tx *gorm.DB) (interface{}, error)
+}
+
+// typedHandler 实现 TypedHandler 接口。
+type typedHandler[Req any, Resp any] struct {
+	fn func(ctx context.Context, req *Req, tx *gorm.DB) (Resp, error)
+}
+
+// Handle 创建泛型处理函数，Req 作为 Bind 完成绑定与校验，返回值作为 JSON 响应数据。
+// 处理函数在事务中执行，返回错误时回滚并交由 bm.Res.Fail 渲染，可返回 *bm.Error 指定状态码与错误码。
+// fn: 处理函数。
+func Handle[Req any, Resp any](fn func(ctx context.Context, req *Req, tx *gorm.DB) (Resp, error)) TypedHandler {
+	return typedHandler[Req, Resp]{fn: fn}
+}
+
+func (t typedHandler[Req, Resp]) bind() interface{} {
+	var req Req
+	return req
+}
+
+func (t typedHandler[Req, Resp]) serve(ctx context.Context, bindData interface{}, tx *gorm.DB) (interface{}, error) {
+	req, ok := bindData.(*Req)
+	if !ok {
+		// Req 没有可绑定的字段时 bindData 为空。
+		req = new(Req)
+	}
+	return t.fn(ctx, req, tx)
+}
+
+// serveTyped 在事务中调用泛型处理函数。
+func (h *handler) serveTyped(bindData interface{}, currentDB *gorm.DB, response *bm.Res) *bm.Res {
+	var data interface{}
+	err := currentDB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		data, err = h.Router.Typed.serve(h.ctx, bindData, tx)
+		return err
+	}, h.txOptions()...)
+	if err != nil {
+		return response.Fail(err)
+	}
+	return response.SucJson(data)
+}
+
+// initTypedBind 使用泛型处理函数的 Req 作为 Bind，已设置 Bind 时要求类型一致。
+// router: 路由器。
+func initTypedBind(router *Router) error {
+	if router.Typed == nil {
+		return nil
+	}
+	if router.Handler != nil {
+		return fmt.Errorf("%s(%s): Router.Typed cannot be used with Router.Handler", router.completePath, router.completeName)
+	}
+
+	bind := router.Typed.bind()
+	if router.Bind == nil {
+		router.Bind = bind
+		return nil
+	}
+	if reflect.TypeOf(router.Bind) != reflect.TypeOf(bind) {
+		return fmt.Errorf("%s(%s): Router.Bind type %T does not match Router.Typed request type %T", router.completePath, router.completeName, router.Bind, bind)
+	}
+	return nil
+}
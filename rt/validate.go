@@ -37,3 +37,28 @@ func ValidateStruct(data interface{}) validator.ValidationErrorsTranslations {
 	}
 	return nil
 }
+
+// fieldError 单个字段的验证错误。
+type fieldError struct {
+	field string // 结构体字段名
+	msg   string // 翻译后的错误信息
+}
+
+// validateFields 验证结构体并按字段返回错误信息。
+// data: 需要验证的结构体。
+// 返回字段错误列表。
+func validateFields(data interface{}) []fieldError {
+	err := validate.Struct(data)
+	if err == nil {
+		return nil
+	}
+	errs, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return []fieldError{{msg: err.Error()}}
+	}
+	fieldErrors := make([]fieldError, 0, len(errs))
+	for _, e := range errs {
+		fieldErrors = append(fieldErrors, fieldError{field: e.StructField(), msg: e.Translate(trans)})
+	}
+	return fieldErrors
+}
@@ -0,0 +1,39 @@
+// Package rt 提供了 WebSocket 路由的处理逻辑。
+package rt
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/QingShan-Xu/web/au"
+	"github.com/QingShan-Xu/web/bm"
+	"github.com/QingShan-Xu/web/ds"
+	"github.com/QingShan-Xu/web/ws"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+)
+
+// serveWebSocket 升级连接并调用 WebSocket 处理函数，处理函数返回后关闭连接。
+// 升级失败时 ws.Upgrade 已写出错误响应。
+func (h *handler) serveWebSocket(w http.ResponseWriter, r *http.Request, bindReader ds.FieldReader, currentDB *gorm.DB, response *bm.Res) *bm.Res {
+	conn, err := ws.Upgrade(w, r, h.Router.Origins)
+	if err != nil {
+		log.Printf("%s(%s): websocket upgrade: %v", h.Router.completePath, h.Router.completeName, err)
+		return response.SucUpgrade()
+	}
+
+	principal, _ := au.FromContext(r.Context())
+	err = h.Router.WebSocket(WebSocketParams{
+		R:          r,
+		BindReader: NewBinderReader(bindReader),
+		Principal:  principal,
+		DB:         currentDB.WithContext(conn.Context()),
+		Conn:       conn,
+	})
+	if err != nil {
+		conn.Close(websocket.CloseInternalServerErr, err.Error())
+	} else {
+		conn.Close(websocket.CloseNormalClosure, "")
+	}
+	return response.SucUpgrade()
+}
@@ -0,0 +1,272 @@
+// Package ws 提供了 WebSocket 连接的封装，包括 JSON 消息读写、心跳保活与优雅关闭。
+package ws
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	WriteWait        = 10 * time.Second  // 写超时
+	PongWait         = 60 * time.Second  // 等待 pong 的超时，超时未收到任何消息视为断开
+	PingPeriod       = PongWait * 9 / 10 // ping 间隔，必须小于 PongWait
+	MaxMessageSize   = 1 << 20           // 单条消息的最大字节数
+	CloseGracePeriod = time.Second       // 发送关闭帧后等待对端确认的时间
+	SendBufferSize   = 256               // 广播消息的发送队列长度，队列已满的连接将被关闭
+	maxCloseReason   = 123               // 关闭原因的最大字节数
+)
+
+// ErrClosed 连接已关闭。
+var ErrClosed = errors.New("ws: connection closed")
+
+// Conn 是 WebSocket 连接，写操作可在多个 goroutine 中并发调用，读操作只能由一个 goroutine 调用。
+type Conn struct {
+	conn    *websocket.Conn
+	req     *http.Request
+	ctx     context.Context
+	cancel  context.CancelFunc
+	writeMu sync.Mutex
+	reading atomic.Bool
+	once    sync.Once
+	hubsMu  sync.Mutex
+	hubs    map[*Hub]struct{}
+	send    chan *websocket.PreparedMessage
+}
+
+// Upgrade 将 HTTP 连接升级为 WebSocket 连接并启动心跳。
+// w: HTTP 响应写入器。
+// r: HTTP 请求。
+// origins: 允许的 Origin 列表，支持 "*"，为空时仅允许同源请求。
+// 返回连接或错误信息，失败时已向客户端写出错误响应。
+func Upgrade(w http.ResponseWriter, r *http.Request, origins []string) (*Conn, error) {
+	upgrader := websocket.Upgrader{CheckOrigin: checkOrigin(origins)}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Conn{
+		conn:   conn,
+		req:    r,
+		ctx:    ctx,
+		cancel: cancel,
+		hubs:   map[*Hub]struct{}{},
+		send:   make(chan *websocket.PreparedMessage, SendBufferSize),
+	}
+
+	conn.SetReadLimit(MaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(PongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(PongWait))
+	})
+	go c.keepalive()
+	go c.writeLoop()
+	return c, nil
+}
+
+// checkOrigin 生成 Origin 校验函数。
+func checkOrigin(origins []string) func(r *http.Request) bool {
+	if len(origins) == 0 {
+		return nil
+	}
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		u, err := url.Parse(origin)
+		if err != nil {
+			return false
+		}
+		for _, allowed := range origins {
+			if allowed == "*" || strings.EqualFold(allowed, origin) || strings.EqualFold(allowed, u.Host) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// keepalive 定期发送 ping，连接关闭后退出。
+func (c *Conn) keepalive() {
+	ticker := time.NewTicker(PingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(WriteWait)); err != nil {
+				c.shutdown()
+				return
+			}
+		}
+	}
+}
+
+// Request 返回升级时的 HTTP 请求。
+func (c *Conn) Request() *http.Request {
+	return c.req
+}
+
+// Context 返回连接关闭时取消的上下文。
+func (c *Conn) Context() context.Context {
+	return c.ctx
+}
+
+// ReadJSON 读取一条消息并解码为 JSON。
+// v: 解码目标的指针。
+func (c *Conn) ReadJSON(v interface{}) error {
+	c.reading.Store(true)
+	defer c.reading.Store(false)
+
+	if err := c.conn.ReadJSON(v); err != nil {
+		c.shutdown()
+		return err
+	}
+	return nil
+}
+
+// ReadMessage 读取一条原始消息。
+// 返回消息类型（websocket.TextMessage 或 websocket.BinaryMessage）、内容或错误信息。
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	c.reading.Store(true)
+	defer c.reading.Store(false)
+
+	messageType, data, err := c.conn.ReadMessage()
+	if err != nil {
+		c.shutdown()
+	}
+	return messageType, data, err
+}
+
+// WriteJSON 以文本消息写出 JSON。
+// v: 要写出的值。
+func (c *Conn) WriteJSON(v interface{}) error {
+	return c.write(func() error {
+		return c.conn.WriteJSON(v)
+	})
+}
+
+// WriteMessage 写出一条原始消息。
+// messageType: 消息类型。
+// data: 消息内容。
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	return c.write(func() error {
+		return c.conn.WriteMessage(messageType, data)
+	})
+}
+
+// enqueue 将广播消息放入发送队列，不阻塞调用方。
+// 队列已满说明客户端读取过慢，此时关闭连接并返回 false。
+func (c *Conn) enqueue(message *websocket.PreparedMessage) bool {
+	if c.ctx.Err() != nil {
+		return false
+	}
+	select {
+	case c.send <- message:
+		return true
+	default:
+		c.shutdown()
+		return false
+	}
+}
+
+// writeLoop 依次写出发送队列中的广播消息，连接关闭后退出。
+func (c *Conn) writeLoop() {
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case message := <-c.send:
+			err := c.write(func() error {
+				return c.conn.WritePreparedMessage(message)
+			})
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (c *Conn) write(fn func() error) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.ctx.Err() != nil {
+		return ErrClosed
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(WriteWait))
+	if err := fn(); err != nil {
+		c.shutdown()
+		return err
+	}
+	return nil
+}
+
+// Close 发送关闭帧并关闭连接，可重复调用。
+// code: 关闭码，例如 websocket.CloseNormalClosure。
+// reason: 关闭原因。
+func (c *Conn) Close(code int, reason string) error {
+	if c.ctx.Err() != nil {
+		return nil
+	}
+
+	// 关闭帧的内容最长 125 字节，其中 2 字节为关闭码。
+	if len(reason) > maxCloseReason {
+		reason = reason[:maxCloseReason]
+		for !utf8.ValidString(reason) {
+			reason = reason[:len(reason)-1]
+		}
+	}
+
+	c.writeMu.Lock()
+	message := websocket.FormatCloseMessage(code, reason)
+	err := c.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(WriteWait))
+	c.writeMu.Unlock()
+
+	// 等待对端的关闭帧：没有读循环时自行读取，否则等待读循环结束或超时。
+	if err == nil {
+		if c.reading.Load() {
+			select {
+			case <-c.ctx.Done():
+			case <-time.After(CloseGracePeriod):
+			}
+		} else {
+			c.conn.SetReadDeadline(time.Now().Add(CloseGracePeriod))
+			for {
+				if _, _, err := c.conn.NextReader(); err != nil {
+					break
+				}
+			}
+		}
+	}
+	c.shutdown()
+	return err
+}
+
+// shutdown 关闭底层连接并退出所有 Hub。
+func (c *Conn) shutdown() {
+	c.once.Do(func() {
+		c.cancel()
+		c.conn.Close()
+
+		c.hubsMu.Lock()
+		hubs := c.hubs
+		c.hubs = map[*Hub]struct{}{}
+		c.hubsMu.Unlock()
+		for hub := range hubs {
+			hub.LeaveAll(c)
+		}
+	})
+}
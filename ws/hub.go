@@ -0,0 +1,117 @@
+package ws
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// Hub 按房间管理连接并广播消息，连接关闭时自动退出所有房间。
+type Hub struct {
+	mu    sync.RWMutex
+	rooms map[string]map[*Conn]struct{}
+}
+
+// NewHub 创建一个 Hub。
+func NewHub() *Hub {
+	return &Hub{rooms: map[string]map[*Conn]struct{}{}}
+}
+
+// Join 将连接加入房间。
+// room: 房间名称。
+// c: 连接。
+func (h *Hub) Join(room string, c *Conn) {
+	c.hubsMu.Lock()
+	defer c.hubsMu.Unlock()
+	if c.ctx.Err() != nil {
+		return
+	}
+	c.hubs[h] = struct{}{}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.rooms[room] == nil {
+		h.rooms[room] = map[*Conn]struct{}{}
+	}
+	h.rooms[room][c] = struct{}{}
+}
+
+// Leave 将连接移出房间。
+// room: 房间名称。
+// c: 连接。
+func (h *Hub) Leave(room string, c *Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(room, c)
+}
+
+// LeaveAll 将连接移出所有房间。
+// c: 连接。
+func (h *Hub) LeaveAll(c *Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for room := range h.rooms {
+		h.remove(room, c)
+	}
+}
+
+// remove 移出连接并清理空房间，调用方需持有写锁。
+func (h *Hub) remove(room string, c *Conn) {
+	conns, ok := h.rooms[room]
+	if !ok {
+		return
+	}
+	delete(conns, c)
+	if len(conns) == 0 {
+		delete(h.rooms, room)
+	}
+}
+
+// Count 返回房间中的连接数。
+func (h *Hub) Count(room string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.rooms[room])
+}
+
+// Broadcast 向房间中的所有连接发送 JSON 消息，消息放入各连接的发送队列后立即返回。
+// 发送队列已满或写出失败的连接将被关闭并移出。
+// room: 房间名称。
+// v: 要发送的值，只编码一次。
+// except: 不发送的连接，例如消息的发送者。
+func (h *Hub) Broadcast(room string, v interface{}, except ...*Conn) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	message, err := websocket.NewPreparedMessage(websocket.TextMessage, data)
+	if err != nil {
+		return err
+	}
+
+	h.mu.RLock()
+	conns := make([]*Conn, 0, len(h.rooms[room]))
+	for c := range h.rooms[room] {
+		conns = append(conns, c)
+	}
+	h.mu.RUnlock()
+
+	for _, c := range conns {
+		if isExcept(c, except) {
+			continue
+		}
+		// 队列已满时连接已在 enqueue 中关闭并退出 Hub，慢速客户端不会阻塞其他连接。
+		c.enqueue(message)
+	}
+	return nil
+}
+
+func isExcept(c *Conn, except []*Conn) bool {
+	for _, e := range except {
+		if e == c {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package ws_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/QingShan-Xu/web/ws"
+	"github.com/gorilla/websocket"
+)
+
+// TestHubSlowClient 测试不读取消息的客户端不会阻塞广播，并在发送队列满后被移出房间
+func TestHubSlowClient(t *testing.T) {
+	hub := ws.NewHub()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := ws.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		hub.Join("room", conn)
+		<-conn.Context().Done()
+	}))
+	defer server.Close()
+
+	dial := func() *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+		if err != nil {
+			t.Fatalf("Dial: %v", err)
+		}
+		return conn
+	}
+	fast, slow := dial(), dial()
+	defer fast.Close()
+	defer slow.Close()
+	for deadline := time.Now().Add(time.Second); hub.Count("room") != 2; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected 2 connections, got %d", hub.Count("room"))
+		}
+	}
+
+	// slow 从不读取，其 TCP 缓冲区与发送队列填满后被关闭。
+	payload := strings.Repeat("x", 64<<10)
+	for i := 0; hub.Count("room") == 2; i++ {
+		if i == 5000 {
+			t.Fatal("Expected the slow client to be dropped")
+		}
+		start := time.Now()
+		if err := hub.Broadcast("room", payload); err != nil {
+			t.Fatalf("Broadcast: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("Broadcast blocked for %v", elapsed)
+		}
+		if _, _, err := fast.ReadMessage(); err != nil {
+			t.Fatalf("Fast client ReadMessage: %v", err)
+		}
+	}
+
+	// 剩余的连接仍可正常接收。
+	if err := hub.Broadcast("room", "done"); err != nil {
+		t.Fatalf("Broadcast: %v", err)
+	}
+	if _, message, err := fast.ReadMessage(); err != nil || string(message) != `"done"` {
+		t.Errorf("Unexpected message %s, %v", message, err)
+	}
+}